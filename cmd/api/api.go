@@ -8,8 +8,12 @@ import (
 	"github.com/edwrdc/digitally/docs" // docs is generated by Swag CLI, you have to import it.
 	"github.com/edwrdc/digitally/internal/auth"
 	"github.com/edwrdc/digitally/internal/mailer"
+	"github.com/edwrdc/digitally/internal/moderation"
+	"github.com/edwrdc/digitally/internal/payment"
+	"github.com/edwrdc/digitally/internal/search"
 	"github.com/edwrdc/digitally/internal/store"
 	"github.com/edwrdc/digitally/internal/store/cache"
+	"github.com/edwrdc/digitally/internal/tax"
 	"go.uber.org/zap"
 )
 
@@ -20,6 +24,11 @@ type application struct {
 	logger        *zap.SugaredLogger
 	mailer        mailer.Client
 	authenticator auth.Authenticator
+	payments      payment.Provider
+	tax           *tax.Calculator
+	moderation    *moderation.Filter
+	cursors       *store.CursorCodec
+	searchIndex   search.Index
 }
 
 type config struct {
@@ -31,6 +40,14 @@ type config struct {
 	mail        mailConfig
 	auth        authConfig
 	redisCfg    redisConfig
+	subs        subscriptionConfig
+	moderation  moderationConfig
+	digests     digestConfig
+	feed        feedConfig
+	pagination  paginationConfig
+	search      searchConfig
+	suggest     suggestConfig
+	recommend   recommendationConfig
 }
 
 type dbConfig struct {
@@ -79,6 +96,58 @@ type redisConfig struct {
 	enabled bool
 }
 
+type digestConfig struct {
+	schedulerInterval time.Duration
+	period            time.Duration
+}
+
+type feedConfig struct {
+	ranking store.FeedRanking
+}
+
+// searchConfig sets up the search index. Postgres searches the catalogue
+// itself unless it is enabled.
+type searchConfig struct {
+	enabled    bool
+	indexPath  string
+	maxMatches int
+}
+
+// suggestConfig tunes the search box suggestions. A prefix is hot, and its
+// suggestions cached, once it was typed hotPrefixHits times within a minute.
+type suggestConfig struct {
+	limit            int
+	budget           time.Duration
+	popularityWeight float64
+	hotPrefixHits    int64
+}
+
+// recommendationConfig schedules the refresh of the trending and related
+// products, limit of each being kept. Each refresh is given up after
+// refreshTimeout.
+type recommendationConfig struct {
+	schedulerInterval time.Duration
+	refreshTimeout    time.Duration
+	limit             int
+	trending          store.TrendingRanking
+	related           store.RelatedEvents
+}
+
+type paginationConfig struct {
+	cursorSecret string
+}
+
+type moderationConfig struct {
+	blockedWords []string
+	maxLinks     int
+}
+
+type subscriptionConfig struct {
+	schedulerInterval time.Duration
+	gracePeriod       time.Duration
+	retryInterval     time.Duration
+}
+
 func (app *application) run() error {
 	// Docs
 	docs.SwaggerInfo.Version = version
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/edwrdc/digitally/internal/store"
+)
+
+var (
+	errBundleNotDiscounted = errors.New("a bundle must cost less than its products bought separately")
+	errBundleMemberPricing = errors.New("a bundle can only contain products sold at a fixed price")
+)
+
+type CreateBundlePayload struct {
+	Name        string   `json:"name" validate:"required,max=100"`
+	Price       float64  `json:"price" validate:"required,number,gt=0"`
+	Description string   `json:"description" validate:"required,max=1000"`
+	Categories  []string `json:"categories" validate:"required,min=1,max=5"`
+	Type        string   `json:"type" validate:"omitempty,oneof=file service item"`
+	ProductIDs  []int64  `json:"product_ids" validate:"required,min=2,max=20,unique,dive,gt=0"`
+}
+
+// CreateBundle godoc
+//
+//	@Summary		Create a bundle
+//	@Description	Bundles several of the seller's own fixed price products at a combined price, which must be lower than buying them separately
+//	@Tags			products
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateBundlePayload	true	"Bundle details"
+//	@Success		201		{object}	store.Product
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/bundles [post]
+func (app *application) createBundleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateBundlePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	categories, err := app.normalizeCategories(ctx, payload.Categories)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnknownCategory):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	members := make([]store.Product, 0, len(payload.ProductIDs))
+	for _, id := range payload.ProductIDs {
+		product, err := app.store.Products.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if product.UserID != user.ID {
+			app.badRequestResponse(w, r, fmt.Errorf("product %d belongs to another seller", product.ID))
+			return
+		}
+
+		if product.IsBundle {
+			app.badRequestResponse(w, r, fmt.Errorf("product %d is a bundle itself", product.ID))
+			return
+		}
+
+		members = append(members, *product)
+	}
+
+	if err := validateBundlePrice(payload.Price, members); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	bundle := &store.Product{
+		UserID:         user.ID,
+		Name:           payload.Name,
+		Price:          payload.Price,
+		PricingMode:    store.PricingModeFixed,
+		Description:    payload.Description,
+		Categories:     categories,
+		Type:           payload.Type,
+		BundleProducts: members,
+	}
+
+	if err := app.store.Bundles.Create(ctx, bundle, payload.ProductIDs); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.indexProduct(ctx, bundle)
+
+	if err := app.jsonResponse(w, http.StatusCreated, bundle); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateBundlePrice makes sure a bundle stays cheaper than its products
+// bought one by one. Pay what you want and free products have no price to
+// compare against, so they cannot be part of a bundle.
+func validateBundlePrice(price float64, members []store.Product) error {
+	var total float64
+	for _, member := range members {
+		if member.PricingMode != store.PricingModeFixed {
+			return fmt.Errorf("%w: product %d is sold as %s", errBundleMemberPricing, member.ID, member.PricingMode)
+		}
+		total += member.Price
+	}
+
+	if price >= total {
+		return fmt.Errorf("%w: bundle price %.2f, products %.2f", errBundleNotDiscounted, price, total)
+	}
+
+	return nil
+}
+
+// validatePriceChange checks that a repriced bundle, or every bundle containing
+// a repriced product, is still discounted.
+func (app *application) validatePriceChange(ctx context.Context, product *store.Product) error {
+	if product.IsBundle {
+		members, err := app.store.Bundles.GetProducts(ctx, product.ID)
+		if err != nil {
+			return err
+		}
+
+		return validateBundlePrice(product.Price, members)
+	}
+
+	bundles, err := app.store.Bundles.GetByProductID(ctx, product.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, bundle := range bundles {
+		members, err := app.store.Bundles.GetProducts(ctx, bundle.ID)
+		if err != nil {
+			return err
+		}
+
+		for i := range members {
+			if members[i].ID == product.ID {
+				members[i] = *product
+			}
+		}
+
+		if err := validateBundlePrice(bundle.Price, members); err != nil {
+			return fmt.Errorf("bundle %q: %w", bundle.Name, err)
+		}
+	}
+
+	return nil
+}
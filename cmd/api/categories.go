@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type categoryKey string
+
+const categoryCtx categoryKey = "category"
+
+var errUnknownCategory = errors.New("unknown category")
+
+type CreateCategoryPayload struct {
+	ParentID    *int64 `json:"parent_id" validate:"omitempty,gt=0"`
+	Slug        string `json:"slug" validate:"required,max=100,slug"`
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=1000"`
+}
+
+// GetCategories godoc
+//
+//	@Summary		List categories
+//	@Description	Lists the category taxonomy: the top-level categories by name, each with its subcategories
+//	@Tags			categories
+//	@Produce		json
+//	@Success		200	{array}		store.Category
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/categories [get]
+func (app *application) getCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := app.store.Categories.GetTree(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, categories); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetCategory godoc
+//
+//	@Summary		Get a category
+//	@Description	Retrieves a category by its ID
+//	@Tags			categories
+//	@Produce		json
+//	@Param			categoryID	path		int	true	"Category ID"
+//	@Success		200			{object}	store.Category
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/categories/{categoryID} [get]
+func (app *application) getCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getCategoryFromContext(r)); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// CreateCategory godoc
+//
+//	@Summary		Create a category
+//	@Description	Adds a category to the taxonomy, under a parent category or at the top level
+//	@Tags			categories
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateCategoryPayload	true	"Category"
+//	@Success		201		{object}	store.Category
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		409		{object}	error	"A category with this slug already exists"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/categories [post]
+func (app *application) createCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateCategoryPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	category := &store.Category{
+		ParentID:    payload.ParentID,
+		Slug:        payload.Slug,
+		Name:        payload.Name,
+		Description: payload.Description,
+	}
+
+	if err := app.store.Categories.Create(r.Context(), category); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, errors.New("parent category not found"))
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, category); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type UpdateCategoryPayload struct {
+	ParentID    *int64  `json:"parent_id" validate:"omitempty,gte=0"`
+	Slug        *string `json:"slug" validate:"omitempty,max=100,slug"`
+	Name        *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=1000"`
+}
+
+// UpdateCategory godoc
+//
+//	@Summary		Update a category
+//	@Description	Changes a category's slug, name, description or parent. A parent_id of 0 moves it to the top level. Renaming the slug renames it on the products in the category too
+//	@Tags			categories
+//	@Accept			json
+//	@Produce		json
+//	@Param			categoryID	path		int						true	"Category ID"
+//	@Param			request		body		UpdateCategoryPayload	true	"Category details to update"
+//	@Success		200			{object}	store.Category
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"A category with this slug already exists"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/categories/{categoryID} [patch]
+func (app *application) updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	category := getCategoryFromContext(r)
+
+	var payload UpdateCategoryPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.ParentID != nil {
+		category.ParentID = payload.ParentID
+		if *payload.ParentID == 0 {
+			category.ParentID = nil
+		}
+	}
+
+	if payload.Slug != nil {
+		category.Slug = *payload.Slug
+	}
+
+	if payload.Name != nil {
+		category.Name = *payload.Name
+	}
+
+	if payload.Description != nil {
+		category.Description = *payload.Description
+	}
+
+	ctx := r.Context()
+
+	productIDs, err := app.store.Categories.Update(ctx, category)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrCategoryCycle):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the index keeps the products' categories, so the renamed slug is
+	// reindexed along with them
+	app.reindexProducts(ctx, productIDs)
+
+	if err := app.jsonResponse(w, http.StatusOK, category); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteCategory godoc
+//
+//	@Summary		Delete a category
+//	@Description	Deletes a category, which must have no subcategories or products left
+//	@Tags			categories
+//	@Produce		json
+//	@Param			categoryID	path		int	true	"Category ID"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"The category still has subcategories or products"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/categories/{categoryID} [delete]
+func (app *application) deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	category := getCategoryFromContext(r)
+
+	if err := app.store.Categories.Delete(r.Context(), category.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrCategoryInUse):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) categoryContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		category, err := app.store.Categories.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, categoryCtx, category)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCategoryFromContext(r *http.Request) *store.Category {
+	return r.Context().Value(categoryCtx).(*store.Category)
+}
+
+// normalizeCategories lowercases the category slugs of a product and drops the
+// duplicates, making sure each is in the taxonomy.
+func (app *application) normalizeCategories(ctx context.Context, categories []string) ([]string, error) {
+	slugs := make([]string, 0, len(categories))
+	for _, category := range categories {
+		slug := strings.ToLower(strings.TrimSpace(category))
+		if !slices.Contains(slugs, slug) {
+			slugs = append(slugs, slug)
+		}
+	}
+
+	unknown, err := app.store.Categories.GetUnknownSlugs(ctx, slugs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: %s", errUnknownCategory, strings.Join(unknown, ", "))
+	}
+
+	return slugs, nil
+}
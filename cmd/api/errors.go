@@ -46,3 +46,15 @@ func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request
 	app.logger.Warnw("Forbidden", "method", r.Method, "path", r.URL.Path)
 	writeJSONError(w, http.StatusForbidden, "Forbidden")
 }
+
+func (app *application) paymentRequiredResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("Payment required", "method", r.Method, "path", r.URL.Path, "error", err)
+	writeJSONError(w, http.StatusPaymentRequired, err.Error())
+}
+
+// orderNotCompletedResponse tells the buyer that the order they were charged
+// for failed, and what became of their payment.
+func (app *application) orderNotCompletedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Errorw("Order not completed", "method", r.Method, "path", r.URL.Path, "error", err)
+	writeJSONError(w, http.StatusInternalServerError, err.Error())
+}
@@ -1,31 +1,115 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/edwrdc/digitally/internal/store"
 )
 
+// CursorPage is a page of a listing. Pass its next_cursor or prev_cursor back
+// as cursor to get the following or previous page; they are left out when
+// there is none.
+type CursorPage[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+func newCursorPage[T any](codec *store.CursorCodec, page *store.Page[T]) CursorPage[T] {
+	return CursorPage[T]{
+		Data:       page.Items,
+		NextCursor: codec.Encode(page.Next),
+		PrevCursor: codec.Encode(page.Prev),
+	}
+}
+
 // GetUserFeed godoc
 //
 //	@Summary		Get user's product feed
-//	@Description	Retrieves a paginated feed of products for the user
+//	@Description	Retrieves a paginated feed of products for the user. By default products are ranked by the sellers the user follows, the categories of the products they wishlisted or bought, and recency
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			limit		query		int		false	"Number of items per page"	default(20)
-//	@Param			offset		query		int		false	"Offset for pagination"		default(0)
-//	@Param			sort		query		string	false	"Sort order (asc/desc)"		default(desc)
-//	@Param			category	query		string	false	"Category to filter by"
-//	@Param			search		query		string	false	"Search term"
+//	@Param			limit		query		int		false	"Number of items per page"								default(20)
+//	@Param			offset		query		int		false	"Offset for pagination, ignored when a cursor is given"	default(0)
+//	@Param			cursor		query		string	false	"Cursor of the page to get"
+//	@Param			sort		query		string	false	"Sort order (asc/desc), rating for the best rated first, recommended, or relevance to the search"	default(recommended)
+//	@Param			sort_by		query		string	false	"Field to sort by (newest/price/rating/wishlisted/best_selling), in the sort order: asc or desc, by default the cheapest first for the price and the highest first otherwise"
+//	@Param			categories	query		string	false	"Comma separated category slugs, matching any of them or their subcategories"
+//	@Param			search		query		string	false	"Search terms, supporting quoted phrases, OR and -excluded words. Matches are highlighted"
+//	@Param			min_rating	query		number	false	"Minimum average rating (0-5)"
+//	@Param			min_price	query		number	false	"Minimum price"
+//	@Param			max_price	query		number	false	"Maximum price"
+//	@Param			seller		query		string	false	"Username of the seller"
+//	@Param			type		query		string	false	"Product type (file/service/item)"
+//	@Param			following	query		bool	false	"Only the products of the sellers the user follows"
 //	@Param			since		query		string	false	"Since date (YYYY-MM-DD)"
 //	@Param			until		query		string	false	"Until date (YYYY-MM-DD)"
-//	@Success		200			{array}		[]store.UserFeedProduct
+//	@Success		200			{object}	CursorPage[store.UserFeedProduct]
 //	@Failure		400			{object}	error
 //	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readFeedQuery(w, r, store.SortRecommended)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.matchSearch(ctx, &fq); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	feed, err := app.store.Products.GetUserFeed(ctx, user.ID, fq, app.config.feed.ranking)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, newCursorPage(app.cursors, feed)); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readFeedQuery reads the filters, sort and page of a product listing, writing
+// a bad request response when they are invalid.
+func (app *application) readFeedQuery(w http.ResponseWriter, r *http.Request, sort string) (store.PaginationFeedQuery, bool) {
+	fq := store.PaginationFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   sort,
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return fq, false
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return fq, false
+	}
+
+	cursor, ok := app.readCursor(w, r)
+	fq.Cursor = cursor
+
+	return fq, ok
+}
+
+// readPage reads the limit and offset of a listing, writing a bad request
+// response when they are invalid.
+func (app *application) readPage(w http.ResponseWriter, r *http.Request) (store.PaginationFeedQuery, bool) {
 	fq := store.PaginationFeedQuery{
 		Limit:  20,
 		Offset: 0,
@@ -34,23 +118,48 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	fq, err := fq.Parse(r)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
-		return
+		return fq, false
 	}
 
 	if err := Validate.Struct(fq); err != nil {
 		app.badRequestResponse(w, r, err)
-		return
+		return fq, false
 	}
 
-	ctx := r.Context()
+	if fq.SortBy != "" {
+		app.badRequestResponse(w, r, errors.New("this listing cannot be sorted by a field"))
+		return fq, false
+	}
+
+	return fq, true
+}
 
-	feed, err := app.store.Products.GetUserFeed(ctx, int64(101), fq)
+// readCursor decodes the cursor of a keyset paginated listing, if any, writing
+// a bad request response when it was tampered with.
+func (app *application) readCursor(w http.ResponseWriter, r *http.Request) (*store.Cursor, bool) {
+	token := r.URL.Query().Get("cursor")
+	if token == "" {
+		return nil, true
+	}
+
+	cursor, err := app.cursors.Decode(token)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+		app.badRequestResponse(w, r, err)
+		return nil, false
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
-		app.serverErrorResponse(w, r, err)
+	return cursor, true
+}
+
+// readListingPage reads the limit, offset and cursor of a keyset paginated
+// listing.
+func (app *application) readListingPage(w http.ResponseWriter, r *http.Request) (store.PaginationFeedQuery, bool) {
+	fq, ok := app.readPage(w, r)
+	if !ok {
+		return fq, false
 	}
+
+	fq.Cursor, ok = app.readCursor(w, r)
+
+	return fq, ok
 }
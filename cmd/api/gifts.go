@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/edwrdc/digitally/internal/mailer"
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type giftKey string
+
+const giftCtx giftKey = "gift"
+
+func (app *application) sendGiftEmail(purchaser *store.User, gift *store.Gift, token string) {
+	vars := struct {
+		PurchaserName string
+		ProductName   string
+		Message       string
+		RedeemURL     string
+		RedeemCode    string
+		RegisterURL   string
+	}{
+		PurchaserName: purchaser.Username,
+		ProductName:   gift.ProductName,
+		Message:       gift.Message,
+		RedeemURL:     fmt.Sprintf("%s/gifts/redeem/%s", app.config.frontendURL, token),
+		RedeemCode:    token,
+		RegisterURL:   fmt.Sprintf("%s/register", app.config.frontendURL),
+	}
+
+	isProdEnv := app.config.env == "production"
+
+	statusCode, err := app.mailer.Send(mailer.GiftReceivedTemplate, gift.RecipientEmail, gift.RecipientEmail, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Errorw("Failed to send gift email", "gift", gift.ID, "error", err)
+		return
+	}
+
+	app.logger.Infow("Gift email sent", "gift", gift.ID, "status code", statusCode)
+}
+
+// GetUserGifts godoc
+//
+//	@Summary		List the gifts bought by the current user
+//	@Description	Lists the gifts the current user has bought for others, with whether they have been redeemed
+//	@Tags			gifts
+//	@Produce		json
+//	@Success		200	{array}		store.Gift
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/gifts [get]
+func (app *application) getUserGiftsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	gifts, err := app.store.Gifts.GetByPurchaserID(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, gifts); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetGift godoc
+//
+//	@Summary		Get a gift's status
+//	@Description	Retrieves a gift bought by the current user, including whether it has been redeemed
+//	@Tags			gifts
+//	@Produce		json
+//	@Param			giftID	path		int	true	"Gift ID"
+//	@Success		200		{object}	store.Gift
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/gifts/{giftID} [get]
+func (app *application) getGiftHandler(w http.ResponseWriter, r *http.Request) {
+	gift := getGiftFromContext(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, gift); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// RedeemGift godoc
+//
+//	@Summary		Redeem a gift
+//	@Description	Adds a gifted product to the current user's library using the token from the gift email
+//	@Tags			gifts
+//	@Produce		json
+//	@Param			token	path		string	true	"Redeem token"
+//	@Success		200		{object}	store.Gift
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"Gift already redeemed or product already owned"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/gifts/redeem/{token} [put]
+func (app *application) redeemGiftHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	gift, err := app.store.Gifts.GetByToken(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if gift.Status == store.GiftStatusRedeemed {
+		app.conflictResponse(w, r, errors.New("this gift has already been redeemed"))
+		return
+	}
+
+	if gift.PurchaserID == user.ID {
+		app.badRequestResponse(w, r, errors.New("you cannot redeem a gift you bought"))
+		return
+	}
+
+	owned, err := app.store.Entitlements.IsOwned(ctx, user.ID, gift.ProductID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// leave the gift pending so the recipient can pass it on
+	if owned {
+		app.conflictResponse(w, r, errors.New("you already own this product"))
+		return
+	}
+
+	if err := app.store.Gifts.Redeem(ctx, gift, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, errors.New("this gift has already been redeemed"))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, gift); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) giftContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "giftID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		gift, err := app.store.Gifts.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// only the purchaser can follow a gift
+		user := getUserFromContext(r)
+		if gift.PurchaserID != user.ID {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, giftCtx, gift)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getGiftFromContext(r *http.Request) *store.Gift {
+	return r.Context().Value(giftCtx).(*store.Gift)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetUserLibrary godoc
+//
+//	@Summary		Get the current user's library
+//	@Description	Retrieves a paginated list of the products the current user owns
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit		query		int		false	"Number of items per page"									default(20)
+//	@Param			offset		query		int		false	"Offset for pagination"										default(0)
+//	@Param			sort		query		string	false	"Sort order (asc/desc), or rating for the best rated first"	default(desc)
+//	@Param			category	query		string	false	"Category to filter by"
+//	@Param			search		query		string	false	"Search term"
+//	@Param			min_rating	query		number	false	"Minimum average rating (0-5)"
+//	@Param			since		query		string	false	"Acquired since date (RFC3339)"
+//	@Param			until		query		string	false	"Acquired until date (RFC3339)"
+//	@Success		200			{array}		store.Entitlement
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/library [get]
+func (app *application) getUserLibraryHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginationFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if fq.Sort == store.SortRecommended {
+		app.badRequestResponse(w, r, errors.New("the library cannot be sorted by recommendation"))
+		return
+	}
+
+	if fq.SortBy != "" {
+		app.badRequestResponse(w, r, errors.New("the library cannot be sorted by a field"))
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	library, err := app.store.Entitlements.GetLibrary(r.Context(), user.ID, fq)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, library); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type GrantEntitlementPayload struct {
+	ProductID int64   `json:"product_id" validate:"required,gt=0"`
+	Release   *string `json:"release" validate:"omitempty,max=100"`
+}
+
+// GrantEntitlement godoc
+//
+//	@Summary		Grant a product to a user
+//	@Description	Adds a product to a user's library as an admin grant, making access given by a subscription permanent
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int						true	"User ID"
+//	@Param			request	body		GrantEntitlementPayload	true	"Product to grant"
+//	@Success		201		{object}	store.Entitlement
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"User already owns the product permanently"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/entitlements [post]
+func (app *application) grantEntitlementHandler(w http.ResponseWriter, r *http.Request) {
+	var payload GrantEntitlementPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	product, err := app.store.Products.GetByID(ctx, payload.ProductID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	entitlement := &store.Entitlement{
+		UserID:    userID,
+		ProductID: product.ID,
+		Release:   payload.Release,
+		Source:    store.EntitlementSourceAdmin,
+		Product:   *product,
+	}
+
+	if err := app.store.Entitlements.Grant(ctx, entitlement); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, entitlement); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// RevokeEntitlement godoc
+//
+//	@Summary		Revoke a product from a user
+//	@Description	Removes a product from a user's library
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID		path		int	true	"User ID"
+//	@Param			productID	path		int	true	"Product ID"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/entitlements/{productID} [delete]
+func (app *application) revokeEntitlementHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	productID, err := strconv.ParseInt(chi.URLParam(r, "productID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Entitlements.Revoke(r.Context(), userID, productID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	"github.com/edwrdc/digitally/internal/auth"
 	"github.com/edwrdc/digitally/internal/db"
 	"github.com/edwrdc/digitally/internal/env"
 	"github.com/edwrdc/digitally/internal/mailer"
+	"github.com/edwrdc/digitally/internal/moderation"
+	"github.com/edwrdc/digitally/internal/payment"
+	"github.com/edwrdc/digitally/internal/search"
 	"github.com/edwrdc/digitally/internal/store"
 	"github.com/edwrdc/digitally/internal/store/cache"
+	"github.com/edwrdc/digitally/internal/tax"
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 )
@@ -70,6 +76,57 @@ func main() {
 				iss:    "digitally",
 			},
 		},
+		subs: subscriptionConfig{
+			schedulerInterval: time.Duration(env.GetInt("SUBSCRIPTIONS_SCHEDULER_INTERVAL", 60)) * time.Second,
+			gracePeriod:       time.Duration(env.GetInt("SUBSCRIPTIONS_GRACE_DAYS", 7)) * time.Hour * 24,
+			retryInterval:     time.Duration(env.GetInt("SUBSCRIPTIONS_RETRY_HOURS", 24)) * time.Hour,
+		},
+		digests: digestConfig{
+			schedulerInterval: time.Duration(env.GetInt("DIGESTS_SCHEDULER_INTERVAL", 15)) * time.Minute,
+			period:            time.Duration(env.GetInt("DIGESTS_PERIOD_HOURS", 24)) * time.Hour,
+		},
+		feed: feedConfig{
+			ranking: store.FeedRanking{
+				FollowedWeight:  env.GetFloat("FEED_FOLLOWED_WEIGHT", 3),
+				CategoryWeight:  env.GetFloat("FEED_CATEGORY_WEIGHT", 2),
+				RecencyWeight:   env.GetFloat("FEED_RECENCY_WEIGHT", 1),
+				RecencyHalfLife: time.Duration(max(env.GetInt("FEED_RECENCY_HALF_LIFE_HOURS", 72), 1)) * time.Hour,
+			},
+		},
+		pagination: paginationConfig{
+			cursorSecret: env.Get("PAGINATION_CURSOR_SECRET", "digitallyio"),
+		},
+		search: searchConfig{
+			enabled:    env.GetBool("SEARCH_INDEX_ENABLED", false),
+			indexPath:  env.Get("SEARCH_INDEX_PATH", "data/search.bleve"),
+			maxMatches: env.GetInt("SEARCH_INDEX_MAX_MATCHES", 1000),
+		},
+		suggest: suggestConfig{
+			limit:            env.GetInt("SUGGEST_LIMIT", 5),
+			budget:           time.Duration(env.GetInt("SUGGEST_BUDGET_MS", 150)) * time.Millisecond,
+			popularityWeight: env.GetFloat("SUGGEST_POPULARITY_WEIGHT", 0.5),
+			hotPrefixHits:    int64(env.GetInt("SUGGEST_HOT_PREFIX_HITS", 3)),
+		},
+		recommend: recommendationConfig{
+			schedulerInterval: time.Duration(env.GetInt("RECOMMENDATIONS_SCHEDULER_INTERVAL", 60)) * time.Minute,
+			refreshTimeout:    time.Duration(env.GetInt("RECOMMENDATIONS_REFRESH_TIMEOUT", 300)) * time.Second,
+			limit:             env.GetInt("RECOMMENDATIONS_LIMIT", 20),
+			trending: store.TrendingRanking{
+				WishlistWeight: env.GetFloat("TRENDING_WISHLIST_WEIGHT", 1),
+				ReviewWeight:   env.GetFloat("TRENDING_REVIEW_WEIGHT", 2),
+				PurchaseWeight: env.GetFloat("TRENDING_PURCHASE_WEIGHT", 3),
+				Window:         time.Duration(env.GetInt("TRENDING_WINDOW_DAYS", 7)) * time.Hour * 24,
+				HalfLife:       time.Duration(max(env.GetInt("TRENDING_HALF_LIFE_HOURS", 24), 1)) * time.Hour,
+			},
+			related: store.RelatedEvents{
+				Window:  time.Duration(env.GetInt("RELATED_WINDOW_DAYS", 180)) * time.Hour * 24,
+				PerUser: env.GetInt("RELATED_PRODUCTS_PER_USER", 50),
+			},
+		},
+		moderation: moderationConfig{
+			blockedWords: strings.Split(env.Get("MODERATION_BLOCKED_WORDS", ""), ","),
+			maxLinks:     env.GetInt("MODERATION_MAX_LINKS", 1),
+		},
 	}
 
 	// Logger
@@ -92,6 +149,19 @@ func main() {
 		logger.Infow("Redis cache connected")
 	}
 
+	// Search index
+	var searchIndex search.Index
+	if cfg.search.enabled {
+		bleveIndex, err := search.OpenBleveIndex(cfg.search.indexPath)
+		if err != nil {
+			logger.Panic(err)
+		}
+
+		searchIndex = bleveIndex
+		logger.Infow("Search index opened", "path", cfg.search.indexPath)
+	}
+
+	cursors := store.NewCursorCodec(cfg.pagination.cursorSecret)
 	store := store.New(db)
 	cacheStorage := cache.NewRedisStorage(redisDB)
 
@@ -114,10 +184,34 @@ func main() {
 		logger:        logger,
 		mailer:        mailer,
 		authenticator: jwtAuthenticator,
+		payments:      payment.NewSandboxProvider(),
+		tax:           tax.NewCalculator(store.TaxRules, tax.NewFormatValidator()),
+		moderation:    moderation.NewFilter(cfg.moderation.blockedWords, cfg.moderation.maxLinks),
+		cursors:       cursors,
+		searchIndex:   searchIndex,
 	}
 
+	// Subscription renewals
+	go app.runSubscriptionScheduler(context.Background())
+
+	// Wishlist price alerts
+	go app.runDigestScheduler(context.Background())
+
+	// Trending and related products
+	go app.runRecommendationScheduler(context.Background())
+
 	app.logger.Infow("Server Started", "env", app.config.env, "addr", app.config.addr)
 
-	logger.Fatal(app.run())
+	err = app.run()
+
+	// logger.Fatal exits without running deferred calls, so the index is
+	// flushed and closed here
+	if searchIndex != nil {
+		if err := searchIndex.Close(); err != nil {
+			logger.Errorw("Failed to close search index", "error", err)
+		}
+	}
+
+	logger.Fatal(err)
 
 }
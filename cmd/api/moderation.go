@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type reviewKey string
+
+const reviewCtx reviewKey = "review"
+
+type reportKey string
+
+const reportCtx reportKey = "report"
+
+type CreateReportPayload struct {
+	Reason  store.ReportReason `json:"reason" validate:"required,oneof=spam offensive fake off_topic other"`
+	Details string             `json:"details" validate:"max=500"`
+}
+
+type ModerateReviewPayload struct {
+	Status store.ReviewStatus `json:"status" validate:"required,oneof=approved rejected hidden"`
+	Note   string             `json:"note" validate:"max=500"`
+}
+
+type ResolveReportPayload struct {
+	Status store.ReportStatus `json:"status" validate:"required,oneof=resolved dismissed"`
+	Note   string             `json:"note" validate:"max=500"`
+}
+
+// ReportProduct godoc
+//
+//	@Summary		Report a product
+//	@Description	Flags a product for the moderators
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			productID	path		int					true	"Product ID"
+//	@Param			request		body		CreateReportPayload	true	"Report"
+//	@Success		201			{object}	store.Report
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"Product already reported"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/reports [post]
+func (app *application) reportProductHandler(w http.ResponseWriter, r *http.Request) {
+	product := getProductFromContext(r)
+
+	app.createReport(w, r, &store.Report{ProductID: &product.ID})
+}
+
+// ReportReview godoc
+//
+//	@Summary		Report a review
+//	@Description	Flags a review for the moderators
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			reviewID	path		int					true	"Review ID"
+//	@Param			request		body		CreateReportPayload	true	"Report"
+//	@Success		201			{object}	store.Report
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"Review already reported"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/reviews/{reviewID}/reports [post]
+func (app *application) reportReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review := getReviewFromContext(r)
+
+	if review.UserID == getUserFromContext(r).ID {
+		app.badRequestResponse(w, r, errors.New("you cannot report your own review"))
+		return
+	}
+
+	app.createReport(w, r, &store.Report{ReviewID: &review.ID})
+}
+
+func (app *application) createReport(w http.ResponseWriter, r *http.Request, report *store.Report) {
+	var payload CreateReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	report.ReporterID = getUserFromContext(r).ID
+	report.Reason = payload.Reason
+	report.Details = payload.Details
+
+	if err := app.store.Moderation.CreateReport(r.Context(), report); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, errors.New("you have already reported this"))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, report); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetModerationQueue godoc
+//
+//	@Summary		Get the moderation queue
+//	@Description	Lists the reviews held by the filter, then the reviews with open reports
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			limit	query		int	false	"Number of items per page"	default(20)
+//	@Param			offset	query		int	false	"Offset for pagination"		default(0)
+//	@Success		200		{array}		store.QueuedReview
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/queue [get]
+func (app *application) getModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readPage(w, r)
+	if !ok {
+		return
+	}
+
+	queue, err := app.store.Moderation.GetQueue(r.Context(), fq)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, queue); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ModerateReview godoc
+//
+//	@Summary		Moderate a review
+//	@Description	Approves, rejects or hides a review and closes its open reports
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			reviewID	path		int						true	"Review ID"
+//	@Param			request		body		ModerateReviewPayload	true	"Decision"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reviews/{reviewID} [patch]
+func (app *application) moderateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.ParseInt(chi.URLParam(r, "reviewID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload ModerateReviewPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	moderator := getUserFromContext(r)
+
+	if err := app.store.Moderation.ModerateReview(r.Context(), reviewID, moderator.ID, payload.Status, payload.Note); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetReports godoc
+//
+//	@Summary		List reports
+//	@Description	Lists the reports with a given status, oldest first
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			status	query		string	false	"Report status (open/resolved/dismissed)"	default(open)
+//	@Param			limit	query		int		false	"Number of items per page"					default(20)
+//	@Param			offset	query		int		false	"Offset for pagination"						default(0)
+//	@Success		200		{array}		store.Report
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports [get]
+func (app *application) getReportsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readPage(w, r)
+	if !ok {
+		return
+	}
+
+	status := store.ReportStatusOpen
+	if s := r.URL.Query().Get("status"); s != "" {
+		status = store.ReportStatus(s)
+	}
+
+	if err := Validate.Var(status, "oneof=open resolved dismissed"); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	reports, err := app.store.Moderation.GetReports(r.Context(), status, fq)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, reports); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ResolveReport godoc
+//
+//	@Summary		Resolve a report
+//	@Description	Closes an open report as resolved or dismissed
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			reportID	path		int						true	"Report ID"
+//	@Param			request		body		ResolveReportPayload	true	"Decision"
+//	@Success		200			{object}	store.Report
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error	"Report not found or already closed"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportID} [patch]
+func (app *application) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResolveReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	report := getReportFromContext(r)
+	moderator := getUserFromContext(r)
+
+	if err := app.store.Moderation.ResolveReport(r.Context(), report, moderator.ID, payload.Status, payload.Note); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, report); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetModerationActions godoc
+//
+//	@Summary		Get the moderation audit trail
+//	@Description	Lists the decisions of the moderators, latest first
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			limit	query		int	false	"Number of items per page"	default(20)
+//	@Param			offset	query		int	false	"Offset for pagination"		default(0)
+//	@Success		200		{array}		store.ModerationAction
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/actions [get]
+func (app *application) getModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readPage(w, r)
+	if !ok {
+		return
+	}
+
+	actions, err := app.store.Moderation.GetActions(r.Context(), fq)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, actions); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reviewContextMiddleware loads a published review.
+func (app *application) reviewContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "reviewID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		review, err := app.store.Reviews.GetByID(ctx, id)
+		if err == nil && review.Status != store.ReviewStatusApproved {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, reviewCtx, review)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getReviewFromContext(r *http.Request) *store.Review {
+	return r.Context().Value(reviewCtx).(*store.Review)
+}
+
+func (app *application) reportContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "reportID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		report, err := app.store.Moderation.GetReportByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, reportCtx, report)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getReportFromContext(r *http.Request) *store.Report {
+	return r.Context().Value(reportCtx).(*store.Report)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/edwrdc/digitally/internal/mailer"
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const digestBatchSize = 100
+
+type UpdateNotificationPreferencesPayload struct {
+	PriceDropAlerts  *bool `json:"price_drop_alerts"`
+	SaleAlerts       *bool `json:"sale_alerts"`
+	NewProductAlerts *bool `json:"new_product_alerts"`
+}
+
+// GetNotificationPreferences godoc
+//
+//	@Summary		Get notification preferences
+//	@Description	Retrieves which alerts about their wishlist and the sellers they follow the current user gets in their daily digest
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	store.NotificationPreferences
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/notifications [get]
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	prefs, err := app.store.Notifications.GetPreferences(r.Context(), getUserFromContext(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// UpdateNotificationPreferences godoc
+//
+//	@Summary		Update notification preferences
+//	@Description	Chooses which alerts about their wishlist and the sellers they follow the current user gets in their daily digest
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		UpdateNotificationPreferencesPayload	true	"Preferences to update"
+//	@Success		200		{object}	store.NotificationPreferences
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/notifications [put]
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateNotificationPreferencesPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	prefs, err := app.store.Notifications.GetPreferences(ctx, getUserFromContext(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if payload.PriceDropAlerts != nil {
+		prefs.PriceDropAlerts = *payload.PriceDropAlerts
+	}
+
+	if payload.SaleAlerts != nil {
+		prefs.SaleAlerts = *payload.SaleAlerts
+	}
+
+	if payload.NewProductAlerts != nil {
+		prefs.NewProductAlerts = *payload.NewProductAlerts
+	}
+
+	if err := app.store.Notifications.UpdatePreferences(ctx, prefs); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Unsubscribe godoc
+//
+//	@Summary		Unsubscribe from alerts
+//	@Description	Turns off every alert of the user the token from the digest email belongs to. No sign in needed
+//	@Tags			users
+//	@Produce		json
+//	@Param			token	path		string	true	"Unsubscribe token"
+//	@Success		204		{object}	nil
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/unsubscribe/{token} [put]
+func (app *application) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := uuid.Parse(chi.URLParam(r, "token"))
+	if err != nil {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	if err := app.store.Notifications.Unsubscribe(r.Context(), token.String()); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runDigestScheduler periodically emails users the price drops and sales of
+// their wishlisted products and the new products of the sellers they follow,
+// at most once per digest period.
+func (app *application) runDigestScheduler(ctx context.Context) {
+	ticker := time.NewTicker(app.config.digests.schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.processDueDigests(ctx)
+		}
+	}
+}
+
+func (app *application) processDueDigests(ctx context.Context) {
+	now := time.Now().UTC()
+	lastDigestBefore := now.Add(-app.config.digests.period)
+
+	digests, err := app.store.Notifications.GetDueDigests(ctx, now, lastDigestBefore, digestBatchSize)
+	if err != nil {
+		app.logger.Errorw("Failed to fetch due digests", "error", err)
+		return
+	}
+
+	for i := range digests {
+		digest := &digests[i]
+
+		// another instance may have claimed the digest in the meantime
+		err := app.store.Notifications.ProcessDigest(ctx, digest, now, lastDigestBefore, app.sendDigestEmail)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			app.logger.Errorw("Failed to send digest", "user", digest.UserID, "error", err)
+		}
+	}
+}
+
+func (app *application) sendDigestEmail(digest *store.Digest) error {
+	type alert struct {
+		Name       string
+		URL        string
+		OldPrice   float64
+		NewPrice   float64
+		SaleEndsAt string
+	}
+
+	alerts := make([]alert, 0, len(digest.Alerts))
+	for _, a := range digest.Alerts {
+		item := alert{
+			Name:     a.ProductName,
+			URL:      fmt.Sprintf("%s/products/%d", app.config.frontendURL, a.ProductID),
+			OldPrice: a.OldPrice,
+			NewPrice: a.NewPrice,
+		}
+		if a.Kind == store.PriceAlertKindSale && a.SaleEndsAt != nil {
+			item.SaleEndsAt = a.SaleEndsAt.Format("January 2, 2006")
+		}
+		alerts = append(alerts, item)
+	}
+
+	type newProduct struct {
+		Name   string
+		URL    string
+		Seller string
+		Price  float64
+	}
+
+	newProducts := make([]newProduct, 0, len(digest.NewProducts))
+	for _, a := range digest.NewProducts {
+		newProducts = append(newProducts, newProduct{
+			Name:   a.ProductName,
+			URL:    fmt.Sprintf("%s/products/%d", app.config.frontendURL, a.ProductID),
+			Seller: a.SellerUsername,
+			Price:  a.Price,
+		})
+	}
+
+	vars := struct {
+		Username       string
+		Alerts         []alert
+		NewProducts    []newProduct
+		SettingsURL    string
+		UnsubscribeURL string
+	}{
+		Username:       digest.Username,
+		Alerts:         alerts,
+		NewProducts:    newProducts,
+		SettingsURL:    fmt.Sprintf("%s/account/notifications", app.config.frontendURL),
+		UnsubscribeURL: fmt.Sprintf("%s/unsubscribe/%s", app.config.frontendURL, digest.UnsubscribeToken),
+	}
+
+	isProdEnv := app.config.env == "production"
+
+	statusCode, err := app.mailer.Send(mailer.WishlistDigestTemplate, digest.Username, digest.Email, vars, !isProdEnv)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Infow("Digest email sent", "user", digest.UserID, "alerts", len(alerts), "new products", len(newProducts), "status code", statusCode)
+
+	return nil
+}
@@ -0,0 +1,608 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edwrdc/digitally/internal/invoice"
+	"github.com/edwrdc/digitally/internal/mailer"
+	"github.com/edwrdc/digitally/internal/payment"
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/edwrdc/digitally/internal/tax"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type orderKey string
+
+const orderCtx orderKey = "order"
+
+type CreateOrderPayload struct {
+	ProductID int64 `json:"product_id" validate:"required,gt=0"`
+	// Amount is what the buyer chooses to pay for a pay what you want product.
+	Amount *float64 `json:"amount" validate:"omitempty,number,gt=0"`
+	// RecipientEmail turns the order into a gift for someone else.
+	RecipientEmail string `json:"recipient_email" validate:"omitempty,email,max=255"`
+	GiftMessage    string `json:"gift_message" validate:"omitempty,max=500"`
+}
+
+// CreateOrder godoc
+//
+//	@Summary		Buy a product
+//	@Description	Charges the buyer the price plus the tax due in their billing country, adds the product to their library and emails the invoice.
+//	@Description	Pay what you want products are charged the chosen amount, or the suggested price when none is given.
+//	@Description	With a recipient email the product is sent as a gift instead, and the recipient is emailed a token to redeem it
+//	@Tags			orders
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateOrderPayload	true	"Product to buy"
+//	@Success		201		{object}	store.Order
+//	@Failure		400		{object}	error	"Invalid payload, own product, gift to yourself or missing billing address"
+//	@Failure		402		{object}	error	"Payment declined"
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"Product already owned by the buyer or gift recipient"
+//	@Failure		500		{object}	error	"Including when the order was paid for but could not be completed, telling whether the payment was refunded"
+//	@Security		ApiKeyAuth
+//	@Router			/orders [post]
+func (app *application) createOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateOrderPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	product, err := app.store.Products.GetByID(ctx, payload.ProductID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if product.UserID == user.ID {
+		app.badRequestResponse(w, r, errors.New("you cannot buy your own product"))
+		return
+	}
+
+	price, err := orderPrice(product, payload.Amount)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	isGift := payload.RecipientEmail != ""
+
+	if isGift && strings.EqualFold(payload.RecipientEmail, user.Email) {
+		app.badRequestResponse(w, r, errors.New("you cannot send a gift to yourself"))
+		return
+	}
+
+	owner := user
+	if isGift {
+		// the recipient may not have an account yet
+		owner, err = app.store.Users.GetByEmail(ctx, payload.RecipientEmail)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if owner != nil {
+		owned, err := app.store.Entitlements.IsOwned(ctx, owner.ID, product.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if owned && isGift {
+			app.conflictResponse(w, r, errors.New("the recipient already owns this product"))
+			return
+		}
+
+		if owned {
+			app.conflictResponse(w, r, errors.New("you already own this product"))
+			return
+		}
+	}
+
+	order := &store.Order{
+		UserID:   user.ID,
+		SellerID: product.UserID,
+		Subtotal: price,
+		Items: []store.OrderItem{
+			{
+				ProductID: &product.ID,
+				Name:      product.Name,
+				UnitPrice: price,
+				Quantity:  1,
+			},
+		},
+	}
+
+	var giftToken string
+	if isGift {
+		giftToken = uuid.New().String()
+
+		// hash the token but keep the plain token for the email
+		hash := sha256.Sum256([]byte(giftToken))
+		order.Gift = &store.Gift{
+			ProductID:      product.ID,
+			ProductName:    product.Name,
+			RecipientEmail: payload.RecipientEmail,
+			Message:        payload.GiftMessage,
+			Token:          hex.EncodeToString(hash[:]),
+		}
+	}
+
+	items := []tax.Item{{ProductType: product.Type, Amount: price}}
+	if err := app.applyTax(ctx, user, order, items); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, errors.New("a billing address is required to place an order"))
+		case errors.Is(err, tax.ErrInvalidVATID):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.placeOrder(ctx, user, order, product.Name); err != nil {
+		switch {
+		case errors.Is(err, payment.ErrDeclined):
+			app.paymentRequiredResponse(w, r, err)
+		case errors.Is(err, errOrderRefunded), errors.Is(err, errOrderUnfulfilled):
+			app.orderNotCompletedResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if isGift {
+		app.sendGiftEmail(user, order.Gift, giftToken)
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, order); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ClaimProduct godoc
+//
+//	@Summary		Claim a free product
+//	@Description	Adds a free product, or a pay what you want product with no minimum, to the current user's library without payment
+//	@Tags			products
+//	@Produce		json
+//	@Param			productID	path		int	true	"Product ID"
+//	@Success		201			{object}	store.Order
+//	@Failure		400			{object}	error	"Product is not free or is the user's own"
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"Product already owned"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/claim [post]
+func (app *application) claimProductHandler(w http.ResponseWriter, r *http.Request) {
+	product := getProductFromContext(r)
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if product.Price != 0 || product.PricingMode == store.PricingModeFixed {
+		app.badRequestResponse(w, r, errors.New("this product is not free"))
+		return
+	}
+
+	if product.UserID == user.ID {
+		app.badRequestResponse(w, r, errors.New("you cannot claim your own product"))
+		return
+	}
+
+	owned, err := app.store.Entitlements.IsOwned(ctx, user.ID, product.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if owned {
+		app.conflictResponse(w, r, errors.New("you already own this product"))
+		return
+	}
+
+	// a zero cost order keeps a record of who claimed the product
+	order := &store.Order{
+		UserID:   user.ID,
+		SellerID: product.UserID,
+		Items: []store.OrderItem{
+			{
+				ProductID: &product.ID,
+				Name:      product.Name,
+				Quantity:  1,
+			},
+		},
+	}
+
+	if err := app.placeOrder(ctx, user, order, product.Name); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, order); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// orderPrice works out what the buyer pays for the product. Pay what you want
+// products default to the suggested price, then to the minimum. Fixed price
+// products cost their sale price while a sale runs.
+func orderPrice(product *store.Product, amount *float64) (float64, error) {
+	switch product.PricingMode {
+	case store.PricingModeFree:
+		return 0, errors.New("this product is free, claim it instead")
+	case store.PricingModePayWhatYouWant:
+		price := product.Price
+		if product.SuggestedPrice != nil {
+			price = *product.SuggestedPrice
+		}
+
+		if amount != nil {
+			price = math.Round(*amount*100) / 100
+		}
+
+		if price < product.Price {
+			return 0, fmt.Errorf("the minimum price for this product is %.2f", product.Price)
+		}
+
+		if price == 0 {
+			return 0, errors.New("choose an amount above zero, or claim the product for free")
+		}
+
+		return price, nil
+	default:
+		return product.CurrentPrice(time.Now().UTC()), nil
+	}
+}
+
+// applyTax charges the tax due in the buyer's billing country on top of the
+// order subtotal. It returns store.ErrNotFound when the buyer has no billing
+// address yet.
+func (app *application) applyTax(ctx context.Context, user *store.User, order *store.Order, items []tax.Item) error {
+	address, err := app.store.BillingAddresses.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	result, err := app.tax.Calculate(ctx, address, items, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	order.BillingCountry = &address.Country
+	order.BillingAddress = &store.PostalAddress{
+		Name:       address.Name,
+		Line1:      address.Line1,
+		Line2:      address.Line2,
+		City:       address.City,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+	}
+	order.BuyerVATID = address.VATID
+	order.ReverseCharge = result.ReverseCharge
+	order.TaxLines = result.Lines
+	order.TaxTotal = result.TaxTotal
+	order.Total = order.Subtotal + order.TaxTotal
+
+	return nil
+}
+
+// placeOrder stores the order, charges the buyer through the payment provider
+// and completes it, refunding the payment when it can't be completed. The confirmation email is best effort: the purchase stands
+// even when it cannot be delivered.
+func (app *application) placeOrder(ctx context.Context, user *store.User, order *store.Order, description string) error {
+	if err := app.store.Orders.Create(ctx, order); err != nil {
+		return err
+	}
+
+	// free claims never reach the payment provider
+	var ref string
+	if order.Total > 0 {
+		var err error
+		ref, err = app.payments.Charge(ctx, payment.Charge{
+			CustomerID:     user.ID,
+			Amount:         order.Total,
+			Description:    description,
+			IdempotencyKey: fmt.Sprintf("order-%d", order.ID),
+		})
+		if err != nil {
+			if err := app.store.Orders.MarkFailed(ctx, order); err != nil {
+				app.logger.Errorw("Failed to mark order as failed", "order", order.ID, "error", err)
+			}
+			return err
+		}
+	}
+
+	if err := app.store.Orders.Complete(ctx, order, ref); err != nil {
+		if ref == "" {
+			return err
+		}
+		return app.refundOrder(ctx, order, ref, err)
+	}
+
+	app.sendPurchaseConfirmation(user, order)
+
+	return nil
+}
+
+var (
+	errOrderRefunded    = errors.New("the order could not be completed, so the payment was refunded")
+	errOrderUnfulfilled = errors.New("the payment was taken but the order could not be completed, it will be refunded")
+)
+
+// refundOrder gives the buyer their payment back when the order they paid for
+// could not be completed, and records what became of the order. A failed
+// refund leaves it unfulfilled, to be refunded by hand. The error returned
+// tells the buyer which.
+func (app *application) refundOrder(ctx context.Context, order *store.Order, ref string, cause error) error {
+	// the request may be what failed, yet the outcome must still be recorded
+	ctx = context.WithoutCancel(ctx)
+
+	status, result := store.OrderStatusRefunded, errOrderRefunded
+	if err := app.payments.Refund(ctx, ref); err != nil {
+		app.logger.Errorw("Payment taken but order could be neither completed nor refunded", "order", order.ID, "payment", ref, "error", cause, "refund_error", err)
+		status, result = store.OrderStatusUnfulfilled, errOrderUnfulfilled
+	} else {
+		app.logger.Errorw("Order could not be completed, payment refunded", "order", order.ID, "payment", ref, "error", cause)
+	}
+
+	if err := app.store.Orders.MarkNotCompleted(ctx, order, status, ref); err != nil {
+		app.logger.Errorw("Failed to record order not completed", "order", order.ID, "status", status, "payment", ref, "error", err)
+	}
+
+	return result
+}
+
+func (app *application) sendPurchaseConfirmation(user *store.User, order *store.Order) {
+	var attachments []mailer.Attachment
+	var invoiceNumber string
+
+	if order.Invoice != nil {
+		doc := invoiceDocument(order)
+		invoiceNumber = doc.Number
+
+		pdf := new(bytes.Buffer)
+		if err := invoice.Render(pdf, doc); err != nil {
+			app.logger.Errorw("Failed to render invoice", "order", order.ID, "error", err)
+		} else {
+			attachments = append(attachments, mailer.Attachment{
+				Filename:    fmt.Sprintf("invoice-%s.pdf", doc.Number),
+				ContentType: "application/pdf",
+				Content:     pdf.Bytes(),
+			})
+		}
+	}
+
+	vars := struct {
+		Username      string
+		OrderID       int64
+		Items         []store.OrderItem
+		Total         float64
+		InvoiceNumber string
+		LibraryURL    string
+		GiftRecipient string
+	}{
+		Username:      user.Username,
+		OrderID:       order.ID,
+		Items:         order.Items,
+		Total:         order.Total,
+		InvoiceNumber: invoiceNumber,
+		LibraryURL:    fmt.Sprintf("%s/library", app.config.frontendURL),
+	}
+
+	if order.Gift != nil {
+		vars.GiftRecipient = order.Gift.RecipientEmail
+	}
+
+	isProdEnv := app.config.env == "production"
+
+	statusCode, err := app.mailer.Send(mailer.PurchaseConfirmationTemplate, user.Username, user.Email, vars, !isProdEnv, attachments...)
+	if err != nil {
+		app.logger.Errorw("Failed to send purchase confirmation email", "order", order.ID, "error", err)
+		return
+	}
+
+	app.logger.Infow("Purchase confirmation email sent", "order", order.ID, "status code", statusCode)
+}
+
+func invoiceDocument(order *store.Order) invoice.Document {
+	doc := invoice.Document{
+		Number:        fmt.Sprintf("%d-%06d", order.Invoice.SellerID, order.Invoice.Number),
+		IssuedAt:      order.Invoice.IssuedAt,
+		OrderID:       order.ID,
+		Seller:        invoiceParty(order.Invoice.SellerName, order.Invoice.SellerEmail, order.Invoice.SellerVATID, order.Invoice.SellerAddress),
+		Buyer:         invoiceParty(order.Invoice.BuyerName, order.Invoice.BuyerEmail, order.BuyerVATID, order.BillingAddress),
+		Subtotal:      order.Subtotal,
+		TaxTotal:      order.TaxTotal,
+		Total:         order.Total,
+		ReverseCharge: order.ReverseCharge,
+	}
+
+	for _, line := range order.TaxLines {
+		doc.TaxLines = append(doc.TaxLines, invoice.TaxLine{
+			Label:  fmt.Sprintf("%s %s%% (%s)", line.Name, strconv.FormatFloat(line.Rate*100, 'f', -1, 64), line.Country),
+			Amount: line.Amount,
+		})
+	}
+
+	for _, item := range order.Items {
+		doc.Lines = append(doc.Lines, invoice.Line{
+			Description: item.Name,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+		})
+	}
+
+	return doc
+}
+
+// invoiceParty prints a party under the name and address they were billed
+// with, falling back to their username for orders that predate the copy.
+func invoiceParty(username, email, vatID string, address *store.PostalAddress) invoice.Party {
+	party := invoice.Party{
+		Name:  username,
+		Email: email,
+		VATID: vatID,
+	}
+
+	if address == nil {
+		return party
+	}
+
+	if address.Name != "" {
+		party.Name = address.Name
+	}
+	party.Address = append(party.Address, address.Line1)
+	if address.Line2 != "" {
+		party.Address = append(party.Address, address.Line2)
+	}
+	party.Address = append(party.Address, strings.TrimSpace(address.PostalCode+" "+address.City), address.Country)
+
+	return party
+}
+
+// GetUserOrders godoc
+//
+//	@Summary		List the current user's orders
+//	@Description	Lists the orders placed by the current user, newest first
+//	@Tags			orders
+//	@Produce		json
+//	@Success		200	{array}		store.Order
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/orders [get]
+func (app *application) getUserOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	orders, err := app.store.Orders.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, orders); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetOrder godoc
+//
+//	@Summary		Get order by ID
+//	@Description	Retrieves an order of the current user, as buyer or seller
+//	@Tags			orders
+//	@Produce		json
+//	@Param			orderID	path		int	true	"Order ID"
+//	@Success		200		{object}	store.Order
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/orders/{orderID} [get]
+func (app *application) getOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order := getOrderFromContext(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, order); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetOrderInvoice godoc
+//
+//	@Summary		Download an order's invoice
+//	@Description	Renders the invoice of a paid order as a PDF document
+//	@Tags			orders
+//	@Produce		application/pdf
+//	@Param			orderID	path		int		true	"Order ID"
+//	@Success		200		{file}		file	"Invoice PDF"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"Order not found or not invoiced yet"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/orders/{orderID}/invoice.pdf [get]
+func (app *application) getOrderInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	order := getOrderFromContext(r)
+
+	if order.Invoice == nil {
+		app.notFoundResponse(w, r, fmt.Errorf("order %d has no invoice", order.ID))
+		return
+	}
+
+	doc := invoiceDocument(order)
+
+	pdf := new(bytes.Buffer)
+	if err := invoice.Render(pdf, doc); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="invoice-%s.pdf"`, doc.Number))
+	w.WriteHeader(http.StatusOK)
+	if _, err := pdf.WriteTo(w); err != nil {
+		app.logger.Errorw("Failed to write invoice", "order", order.ID, "error", err)
+	}
+}
+
+func (app *application) orderContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "orderID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		order, err := app.store.Orders.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// only the buyer and the seller can see an order
+		user := getUserFromContext(r)
+		if order.UserID != user.ID && order.SellerID != user.ID {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, orderCtx, order)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getOrderFromContext(r *http.Request) *store.Order {
+	return r.Context().Value(orderCtx).(*store.Order)
+}
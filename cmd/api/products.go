@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/edwrdc/digitally/internal/store"
 	"github.com/go-chi/chi/v5"
@@ -15,16 +17,19 @@ type productKey string
 const productCtx productKey = "product"
 
 type CreateProductPayload struct {
-	Name        string   `json:"name" validate:"required,max=100"`
-	Price       float64  `json:"price" validate:"required,number,gt=0"`
-	Description string   `json:"description" validate:"required,max=1000"`
-	Categories  []string `json:"categories" validate:"required,min=1,max=5"`
+	Name           string   `json:"name" validate:"required,max=100"`
+	Price          float64  `json:"price" validate:"number,gte=0"`
+	PricingMode    string   `json:"pricing_mode" validate:"omitempty,oneof=fixed pwyw free"`
+	SuggestedPrice *float64 `json:"suggested_price" validate:"omitempty,number,gt=0"`
+	Description    string   `json:"description" validate:"required,max=1000"`
+	Categories     []string `json:"categories" validate:"required,min=1,max=5"`
+	Type           string   `json:"type" validate:"omitempty,oneof=file service item"`
 }
 
 // CreateProduct godoc
 //
 //	@Summary		Create a new product
-//	@Description	Creates a new product with the provided details
+//	@Description	Creates a new product with the provided details. Pay what you want products use the price as the minimum, free products have no price. Categories are given by slug and must be in the taxonomy
 //	@Tags			products
 //	@Accept			json
 //	@Produce		json
@@ -49,19 +54,46 @@ func (app *application) createProductHandler(w http.ResponseWriter, r *http.Requ
 	user := getUserFromContext(r)
 
 	product := &store.Product{
-		UserID:      user.ID,
-		Name:        payload.Name,
-		Price:       payload.Price,
-		Description: payload.Description,
-		Categories:  payload.Categories,
+		UserID:         user.ID,
+		Name:           payload.Name,
+		Price:          payload.Price,
+		PricingMode:    store.PricingMode(payload.PricingMode),
+		SuggestedPrice: payload.SuggestedPrice,
+		Description:    payload.Description,
+		Categories:     payload.Categories,
+		Type:           payload.Type,
 	}
+
+	if product.PricingMode == "" {
+		product.PricingMode = store.PricingModeFixed
+	}
+
+	if err := validatePricing(product); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	ctx := r.Context()
 
+	categories, err := app.normalizeCategories(ctx, product.Categories)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnknownCategory):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	product.Categories = categories
+
 	if err := app.store.Products.Create(ctx, product); err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	app.indexProduct(ctx, product)
+
 	if err := app.jsonResponse(w, http.StatusCreated, product); err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -71,7 +103,7 @@ func (app *application) createProductHandler(w http.ResponseWriter, r *http.Requ
 // GetProduct godoc
 //
 //	@Summary		Get product by ID
-//	@Description	Retrieves a product by its ID, including its reviews
+//	@Description	Retrieves a product by its ID, including its rating summary and most helpful reviews. Its seller also sees how many users wishlisted it
 //	@Tags			products
 //	@Accept			json
 //	@Produce		json
@@ -86,13 +118,38 @@ func (app *application) getProductHandler(w http.ResponseWriter, r *http.Request
 
 	product := getProductFromContext(r)
 
-	reviews, err := app.store.Reviews.GetByProductID(r.Context(), product.ID)
+	top, err := app.store.Reviews.GetByProductID(r.Context(), product.ID, store.ReviewQuery{
+		Limit: topReviewsLimit,
+		Sort:  store.ReviewSortHelpful,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	product.Reviews = top.Items
+
+	owned, err := app.store.Entitlements.IsOwned(r.Context(), getUserFromContext(r).ID, product.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	product.Reviews = reviews
+	product.IsOwned = owned
+
+	if product.UserID != getUserFromContext(r).ID {
+		product.WishlistCount = nil
+	}
+
+	if product.IsBundle {
+		members, err := app.store.Bundles.GetProducts(r.Context(), product.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		product.BundleProducts = members
+	}
 
 	if err := app.jsonResponse(w, http.StatusOK, product); err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -103,7 +160,7 @@ func (app *application) getProductHandler(w http.ResponseWriter, r *http.Request
 // DeleteProduct godoc
 //
 //	@Summary		Delete product
-//	@Description	Deletes a product by its ID
+//	@Description	Deletes a product by its ID. Products that are part of a bundle cannot be deleted
 //	@Tags			products
 //	@Accept			json
 //	@Produce		json
@@ -111,6 +168,7 @@ func (app *application) getProductHandler(w http.ResponseWriter, r *http.Request
 //	@Success		204			{object}	nil
 //	@Failure		400			{object}	error
 //	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"Product is part of a bundle"
 //	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/products/{productID} [delete]
@@ -129,20 +187,27 @@ func (app *application) deleteProductHandler(w http.ResponseWriter, r *http.Requ
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrInBundle):
+			app.conflictResponse(w, r, err)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	app.unindexProduct(ctx, id)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 type UpdateProductPayload struct {
-	Name        *string   `json:"name" validate:"omitempty,max=100"`
-	Price       *float64  `json:"price" validate:"omitempty,number,gt=0"`
-	Description *string   `json:"description" validate:"omitempty,max=1000"`
-	Categories  *[]string `json:"categories" validate:"omitempty,min=1,max=5"`
+	Name           *string   `json:"name" validate:"omitempty,max=100"`
+	Price          *float64  `json:"price" validate:"omitempty,number,gte=0"`
+	PricingMode    *string   `json:"pricing_mode" validate:"omitempty,oneof=fixed pwyw free"`
+	SuggestedPrice *float64  `json:"suggested_price" validate:"omitempty,number,gt=0"`
+	Description    *string   `json:"description" validate:"omitempty,max=1000"`
+	Categories     *[]string `json:"categories" validate:"omitempty,min=1,max=5"`
+	Type           *string   `json:"type" validate:"omitempty,oneof=file service item"`
 }
 
 // UpdateProduct godoc
@@ -157,7 +222,7 @@ type UpdateProductPayload struct {
 //	@Success		200			{object}	store.Product
 //	@Failure		400			{object}	error
 //	@Failure		404			{object}	error
-//	@Failure		409			{object}	error	"Edit conflict"
+//	@Failure		409			{object}	error	"Edit conflict, or the price change would leave a bundle without a discount or with a product not sold at a fixed price"
 //	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/products/{productID} [patch]
@@ -179,16 +244,69 @@ func (app *application) updateProductHandler(w http.ResponseWriter, r *http.Requ
 		product.Name = *payload.Name
 	}
 
+	if payload.PricingMode != nil && store.PricingMode(*payload.PricingMode) != product.PricingMode {
+		if product.IsBundle {
+			app.badRequestResponse(w, r, errors.New("bundles are always sold at a fixed price"))
+			return
+		}
+
+		product.PricingMode = store.PricingMode(*payload.PricingMode)
+
+		// drop what the new mode has no use for, unless it was sent explicitly
+		if product.PricingMode == store.PricingModeFree && payload.Price == nil {
+			product.Price = 0
+		}
+
+		if product.PricingMode != store.PricingModePayWhatYouWant && payload.SuggestedPrice == nil {
+			product.SuggestedPrice = nil
+		}
+	}
+
 	if payload.Price != nil {
 		product.Price = *payload.Price
 	}
 
+	if payload.SuggestedPrice != nil {
+		product.SuggestedPrice = payload.SuggestedPrice
+	}
+
 	if payload.Description != nil {
 		product.Description = *payload.Description
 	}
 
 	if payload.Categories != nil {
-		product.Categories = *payload.Categories
+		categories, err := app.normalizeCategories(r.Context(), *payload.Categories)
+		if err != nil {
+			switch {
+			case errors.Is(err, errUnknownCategory):
+				app.badRequestResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		product.Categories = categories
+	}
+
+	if payload.Type != nil {
+		product.Type = *payload.Type
+	}
+
+	if err := validatePricing(product); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.Price != nil || payload.PricingMode != nil {
+		if err := app.validatePriceChange(r.Context(), product); err != nil {
+			switch {
+			case errors.Is(err, errBundleNotDiscounted), errors.Is(err, errBundleMemberPricing):
+				app.conflictResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
 	}
 
 	if err := app.store.Products.Update(r.Context(), product); err != nil {
@@ -203,12 +321,42 @@ func (app *application) updateProductHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	app.indexProduct(r.Context(), product)
+
 	if err := app.jsonResponse(w, http.StatusOK, product); err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 }
 
+// validatePricing checks the price fields make sense for the pricing mode.
+func validatePricing(product *store.Product) error {
+	switch product.PricingMode {
+	case store.PricingModeFixed:
+		if product.Price <= 0 {
+			return errors.New("fixed price products must cost more than zero")
+		}
+
+		if product.SuggestedPrice != nil {
+			return errors.New("only pay what you want products have a suggested price")
+		}
+	case store.PricingModePayWhatYouWant:
+		if product.SuggestedPrice != nil && *product.SuggestedPrice < product.Price {
+			return errors.New("the suggested price cannot be below the minimum price")
+		}
+	case store.PricingModeFree:
+		if product.Price != 0 {
+			return errors.New("free products cannot have a price")
+		}
+
+		if product.SuggestedPrice != nil {
+			return errors.New("only pay what you want products have a suggested price")
+		}
+	}
+
+	return nil
+}
+
 func (app *application) productContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		productID := chi.URLParam(r, "productID")
@@ -239,3 +387,106 @@ func (app *application) productContextMiddleware(next http.Handler) http.Handler
 func getProductFromContext(r *http.Request) *store.Product {
 	return r.Context().Value(productCtx).(*store.Product)
 }
+
+type ProductSalePayload struct {
+	Price    float64 `json:"price" validate:"gte=0"`
+	StartsAt string  `json:"starts_at" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	EndsAt   string  `json:"ends_at" validate:"required,datetime=2006-01-02T15:04:05Z07:00"`
+}
+
+// UpdateProductSale godoc
+//
+//	@Summary		Put a product on sale
+//	@Description	Lowers the price of a fixed price product between two dates, replacing any previous sale. Users who wishlisted the product are told once the sale starts
+//	@Tags			products
+//	@Accept			json
+//	@Produce		json
+//	@Param			productID	path		int					true	"Product ID"
+//	@Param			request		body		ProductSalePayload	true	"Sale, starting now unless starts_at is given"
+//	@Success		200			{object}	store.Product
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/sale [put]
+func (app *application) updateProductSaleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ProductSalePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	product := getProductFromContext(r)
+
+	if product.PricingMode != store.PricingModeFixed {
+		app.badRequestResponse(w, r, errors.New("only fixed price products can go on sale"))
+		return
+	}
+
+	if payload.Price >= product.Price {
+		app.badRequestResponse(w, r, errors.New("the sale price must be below the product price"))
+		return
+	}
+
+	startsAt := time.Now().UTC()
+	if payload.StartsAt != "" {
+		startsAt, _ = time.Parse(time.RFC3339, payload.StartsAt)
+	}
+
+	endsAt, _ := time.Parse(time.RFC3339, payload.EndsAt)
+	if !endsAt.After(startsAt) || !endsAt.After(time.Now()) {
+		app.badRequestResponse(w, r, errors.New("the sale must end after it starts, and in the future"))
+		return
+	}
+
+	product.Sale = &store.ProductSale{
+		Price:    math.Round(payload.Price*100) / 100,
+		StartsAt: startsAt.Truncate(time.Second),
+		EndsAt:   endsAt.Truncate(time.Second),
+	}
+
+	app.saveProductSale(w, r, product)
+}
+
+// EndProductSale godoc
+//
+//	@Summary		End a product's sale
+//	@Description	Ends or cancels the sale of a product, restoring its price
+//	@Tags			products
+//	@Produce		json
+//	@Param			productID	path		int	true	"Product ID"
+//	@Success		200			{object}	store.Product
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/sale [delete]
+func (app *application) endProductSaleHandler(w http.ResponseWriter, r *http.Request) {
+	product := getProductFromContext(r)
+	product.Sale = nil
+
+	app.saveProductSale(w, r, product)
+}
+
+func (app *application) saveProductSale(w http.ResponseWriter, r *http.Request, product *store.Product) {
+	if err := app.store.Products.UpdateSale(r.Context(), product); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, product); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/edwrdc/digitally/internal/store"
+)
+
+// GetTrendingProducts godoc
+//
+//	@Summary		Get trending products
+//	@Description	Retrieves the products most wishlisted, reviewed and bought lately, recent activity weighing the most. Refreshed periodically
+//	@Tags			products
+//	@Produce		json
+//	@Success		200	{array}		store.RecommendedProduct
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/trending [get]
+func (app *application) getTrendingProductsHandler(w http.ResponseWriter, r *http.Request) {
+	products, err := app.getTrending(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, products); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetRelatedProducts godoc
+//
+//	@Summary		Get related products
+//	@Description	Retrieves the products customers who bought this product also bought, and those who wishlisted it also wishlisted. Refreshed periodically
+//	@Tags			products
+//	@Produce		json
+//	@Param			productID	path		int	true	"Product ID"
+//	@Success		200			{object}	store.RelatedProducts
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/related [get]
+func (app *application) getRelatedProductsHandler(w http.ResponseWriter, r *http.Request) {
+	product := getProductFromContext(r)
+
+	related, err := app.getRelated(r.Context(), product.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, related); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getTrending returns the trending products, from the cache when enabled. The
+// cache failing falls back to the database.
+func (app *application) getTrending(ctx context.Context) ([]store.RecommendedProduct, error) {
+	if !app.config.redisCfg.enabled {
+		return app.store.Recommendations.GetTrending(ctx, app.config.recommend.limit)
+	}
+
+	products, err := app.cacheStorage.Recommendations.GetTrending(ctx)
+	if err != nil {
+		app.logger.Warnw("Failed to get cached trending products", "error", err)
+	}
+	if products != nil {
+		return products, nil
+	}
+
+	products, err = app.store.Recommendations.GetTrending(ctx, app.config.recommend.limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cacheStorage.Recommendations.SetTrending(ctx, products); err != nil {
+		app.logger.Warnw("Failed to cache trending products", "error", err)
+	}
+
+	return products, nil
+}
+
+// getRelated returns the products related to the product, from the cache when
+// enabled. The cache failing falls back to the database.
+func (app *application) getRelated(ctx context.Context, productID int64) (*store.RelatedProducts, error) {
+	if !app.config.redisCfg.enabled {
+		return app.store.Recommendations.GetRelated(ctx, productID, app.config.recommend.limit)
+	}
+
+	related, err := app.cacheStorage.Recommendations.GetRelated(ctx, productID)
+	if err != nil {
+		app.logger.Warnw("Failed to get cached related products", "product", productID, "error", err)
+	}
+	if related != nil {
+		return related, nil
+	}
+
+	related, err = app.store.Recommendations.GetRelated(ctx, productID, app.config.recommend.limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cacheStorage.Recommendations.SetRelated(ctx, productID, related); err != nil {
+		app.logger.Warnw("Failed to cache related products", "product", productID, "error", err)
+	}
+
+	return related, nil
+}
+
+// runRecommendationScheduler periodically recomputes the trending products
+// and the products related by being bought or wishlisted together. They are
+// computed once on start too, so a fresh deployment has some to show.
+func (app *application) runRecommendationScheduler(ctx context.Context) {
+	ticker := time.NewTicker(app.config.recommend.schedulerInterval)
+	defer ticker.Stop()
+
+	app.refreshRecommendations(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.refreshRecommendations(ctx)
+		}
+	}
+}
+
+// refreshRecommendations recomputes the trending then the related products,
+// each within the refresh timeout. A refresh failing leaves the products of
+// the last one in place, and one already running on another instance is
+// skipped.
+func (app *application) refreshRecommendations(ctx context.Context) {
+	now := time.Now().UTC()
+
+	app.refreshRecommendation(ctx, "trending", func(ctx context.Context) error {
+		return app.store.Recommendations.RefreshTrending(ctx, now, app.config.recommend.trending, app.config.recommend.limit)
+	})
+
+	app.refreshRecommendation(ctx, "related", func(ctx context.Context) error {
+		return app.store.Recommendations.RefreshRelated(ctx, now, app.config.recommend.related, app.config.recommend.limit)
+	})
+}
+
+func (app *application) refreshRecommendation(ctx context.Context, kind string, refresh func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(ctx, app.config.recommend.refreshTimeout)
+	defer cancel()
+
+	start := time.Now()
+
+	err := refresh(ctx)
+	if errors.Is(err, store.ErrRefreshInProgress) {
+		app.logger.Infow("Skipped refreshing recommendations, another instance is refreshing them", "kind", kind)
+		return
+	}
+
+	if err != nil {
+		app.logger.Errorw(
+			"Failed to refresh recommendations, keeping the previous ones",
+			"kind", kind,
+			"timed_out", errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded),
+			"duration", time.Since(start),
+			"error", err,
+		)
+		return
+	}
+
+	app.logger.Infow("Refreshed recommendations", "kind", kind, "duration", time.Since(start))
+}
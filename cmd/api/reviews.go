@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/edwrdc/digitally/internal/mailer"
+	"github.com/edwrdc/digitally/internal/store"
+)
+
+// topReviewsLimit is how many reviews the product details embed; the rest are
+// paged through the reviews listing.
+const topReviewsLimit = 3
+
+// ListReviews godoc
+//
+//	@Summary		List a product's reviews
+//	@Description	Retrieves a page of a product's reviews. Pass the next_cursor or prev_cursor of a page as cursor to get the following or previous one
+//	@Tags			reviews
+//	@Produce		json
+//	@Param			productID		path		int		true	"Product ID"
+//	@Param			limit			query		int		false	"Number of reviews per page"					default(10)
+//	@Param			sort			query		string	false	"Sort order (newest/highest/lowest/helpful)"	default(newest)
+//	@Param			rating			query		int		false	"Only reviews with this rating (1-5)"
+//	@Param			verified_only	query		bool	false	"Only reviews from verified purchases"
+//	@Param			cursor			query		string	false	"Cursor of the page to get"
+//	@Success		200				{object}	CursorPage[store.Review]
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/reviews [get]
+func (app *application) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	rq := store.ReviewQuery{
+		Limit: 10,
+		Sort:  store.ReviewSortNewest,
+	}
+	rq, err := rq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(rq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	cursor, ok := app.readCursor(w, r)
+	if !ok {
+		return
+	}
+	rq.Cursor = cursor
+
+	product := getProductFromContext(r)
+
+	page, err := app.store.Reviews.GetByProductID(r.Context(), product.ID, rq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, newCursorPage(app.cursors, page)); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type CreateReviewPayload struct {
+	Rating  int    `json:"rating" validate:"required,min=1,max=5"`
+	Comment string `json:"comment" validate:"max=250"`
+}
+
+// CreateReview godoc
+//
+//	@Summary		Review a product
+//	@Description	Adds the current user's review of a product. Each user can review a product once, and never their own. Reviews that look abusive are held as pending until a moderator approves them
+//	@Tags			reviews
+//	@Accept			json
+//	@Produce		json
+//	@Param			productID	path		int					true	"Product ID"
+//	@Param			request		body		CreateReviewPayload	true	"Review"
+//	@Success		201			{object}	store.Review
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"Product already reviewed"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/reviews [post]
+func (app *application) createReviewHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateReviewPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	product := getProductFromContext(r)
+	user := getUserFromContext(r)
+
+	if product.UserID == user.ID {
+		app.badRequestResponse(w, r, errors.New("you cannot review your own product"))
+		return
+	}
+
+	review := &store.Review{
+		UserID:    user.ID,
+		ProductID: product.ID,
+		Rating:    payload.Rating,
+		Comment:   payload.Comment,
+		Status:    store.ReviewStatusApproved,
+		User:      *user,
+	}
+
+	app.holdForModeration(review)
+
+	if err := app.store.Reviews.Create(r.Context(), review); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, errors.New("you have already reviewed this product"))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, review); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type UpdateReviewPayload struct {
+	Rating  *int    `json:"rating" validate:"omitempty,min=1,max=5"`
+	Comment *string `json:"comment" validate:"omitempty,max=250"`
+}
+
+// UpdateReview godoc
+//
+//	@Summary		Update your review
+//	@Description	Updates the current user's review of a product
+//	@Tags			reviews
+//	@Accept			json
+//	@Produce		json
+//	@Param			productID	path		int					true	"Product ID"
+//	@Param			request		body		UpdateReviewPayload	true	"Review details to update"
+//	@Success		200			{object}	store.Review
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error	"Product not found or not reviewed yet"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/reviews [patch]
+func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateReviewPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	product := getProductFromContext(r)
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	review, err := app.store.Reviews.GetByUserAndProduct(ctx, user.ID, product.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if payload.Rating != nil {
+		review.Rating = *payload.Rating
+	}
+
+	if payload.Comment != nil {
+		review.Comment = *payload.Comment
+		app.holdForModeration(review)
+	}
+
+	if err := app.store.Reviews.Update(ctx, review); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, review); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteReview godoc
+//
+//	@Summary		Delete your review
+//	@Description	Deletes the current user's review of a product
+//	@Tags			reviews
+//	@Produce		json
+//	@Param			productID	path		int	true	"Product ID"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error	"Product not found or not reviewed yet"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/reviews [delete]
+func (app *application) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	product := getProductFromContext(r)
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	review, err := app.store.Reviews.GetByUserAndProduct(ctx, user.ID, product.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Reviews.Delete(ctx, review.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// holdForModeration runs the review's comment through the moderation filter,
+// holding it as pending when it looks suspicious. A held review whose comment
+// was fixed is published again; rejected and hidden reviews stay so.
+func (app *application) holdForModeration(review *store.Review) {
+	reasons := app.moderation.Check(review.Comment)
+
+	switch {
+	case len(reasons) > 0:
+		if review.Status == store.ReviewStatusApproved || review.Status == store.ReviewStatusPending {
+			review.Status = store.ReviewStatusPending
+			app.logger.Infow("review held for moderation", "user", review.UserID, "product", review.ProductID, "reasons", reasons)
+		}
+	case review.Status == store.ReviewStatusPending:
+		review.Status = store.ReviewStatusApproved
+	}
+}
+
+// GetProductRatings godoc
+//
+//	@Summary		Get a product's ratings
+//	@Description	Retrieves the average rating of a product and how many reviews gave each number of stars
+//	@Tags			reviews
+//	@Produce		json
+//	@Param			productID	path		int	true	"Product ID"
+//	@Success		200			{object}	store.RatingSummary
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/ratings [get]
+func (app *application) getProductRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	product := getProductFromContext(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, product.Rating); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// VoteReview godoc
+//
+//	@Summary		Vote a review helpful
+//	@Description	Marks a review as helpful. Each user can vote once per review, and not on their own
+//	@Tags			reviews
+//	@Produce		json
+//	@Param			reviewID	path		int	true	"Review ID"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"Review already voted"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/reviews/{reviewID}/vote [put]
+func (app *application) voteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review := getReviewFromContext(r)
+	user := getUserFromContext(r)
+
+	if review.UserID == user.ID {
+		app.badRequestResponse(w, r, errors.New("you cannot vote on your own review"))
+		return
+	}
+
+	if err := app.store.Reviews.Vote(r.Context(), review.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, errors.New("you have already voted on this review"))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnvoteReview godoc
+//
+//	@Summary		Remove your vote from a review
+//	@Description	Takes back the current user's helpful vote on a review
+//	@Tags			reviews
+//	@Produce		json
+//	@Param			reviewID	path		int	true	"Review ID"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error	"Review not found or not voted"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/reviews/{reviewID}/vote [delete]
+func (app *application) unvoteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review := getReviewFromContext(r)
+	user := getUserFromContext(r)
+
+	if err := app.store.Reviews.Unvote(r.Context(), review.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type ReviewResponsePayload struct {
+	Body string `json:"body" validate:"required,max=1000"`
+}
+
+// SaveReviewResponse godoc
+//
+//	@Summary		Respond to a review
+//	@Description	Publishes the seller's reply to a review of their product, or edits it. The reviewer is emailed the first reply
+//	@Tags			reviews
+//	@Accept			json
+//	@Produce		json
+//	@Param			reviewID	path		int						true	"Review ID"
+//	@Param			request		body		ReviewResponsePayload	true	"Response"
+//	@Success		200			{object}	store.ReviewResponse
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/reviews/{reviewID}/response [put]
+func (app *application) saveReviewResponseHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ReviewResponsePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	review := getReviewFromContext(r)
+	seller := getUserFromContext(r)
+
+	product, ok := app.reviewedProductOwnedBy(w, r, review, seller)
+	if !ok {
+		return
+	}
+
+	response := &store.ReviewResponse{
+		ReviewID: review.ID,
+		SellerID: seller.ID,
+		Body:     payload.Body,
+	}
+
+	created, err := app.store.Reviews.SaveResponse(r.Context(), response)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if created {
+		app.sendReviewResponseEmail(r.Context(), review, product, seller, response)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteReviewResponse godoc
+//
+//	@Summary		Delete a review response
+//	@Description	Removes the seller's reply to a review of their product
+//	@Tags			reviews
+//	@Produce		json
+//	@Param			reviewID	path		int	true	"Review ID"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error	"Review not found or not responded to"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/reviews/{reviewID}/response [delete]
+func (app *application) deleteReviewResponseHandler(w http.ResponseWriter, r *http.Request) {
+	review := getReviewFromContext(r)
+
+	if _, ok := app.reviewedProductOwnedBy(w, r, review, getUserFromContext(r)); !ok {
+		return
+	}
+
+	if err := app.store.Reviews.DeleteResponse(r.Context(), review.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reviewedProductOwnedBy loads the product of the review, writing a forbidden
+// response unless the user sells it.
+func (app *application) reviewedProductOwnedBy(w http.ResponseWriter, r *http.Request, review *store.Review, user *store.User) (*store.Product, bool) {
+	product, err := app.store.Products.GetByID(r.Context(), review.ProductID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if product.UserID != user.ID {
+		app.forbiddenResponse(w, r)
+		return nil, false
+	}
+
+	return product, true
+}
+
+func (app *application) sendReviewResponseEmail(ctx context.Context, review *store.Review, product *store.Product, seller *store.User, response *store.ReviewResponse) {
+	reviewer, err := app.store.Users.GetByID(ctx, review.UserID)
+	if err != nil {
+		app.logger.Errorw("Failed to load reviewer", "review", review.ID, "error", err)
+		return
+	}
+
+	vars := struct {
+		Username    string
+		SellerName  string
+		ProductName string
+		Response    string
+		ProductURL  string
+	}{
+		Username:    reviewer.Username,
+		SellerName:  seller.Username,
+		ProductName: product.Name,
+		Response:    response.Body,
+		ProductURL:  fmt.Sprintf("%s/products/%d", app.config.frontendURL, product.ID),
+	}
+
+	isProdEnv := app.config.env == "production"
+
+	statusCode, err := app.mailer.Send(mailer.ReviewResponseTemplate, reviewer.Username, reviewer.Email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Errorw("Failed to send review response email", "review", review.ID, "error", err)
+		return
+	}
+
+	app.logger.Infow("Review response email sent", "review", review.ID, "status code", statusCode)
+}
@@ -31,32 +31,200 @@ func (app *application) routes() http.Handler {
 			r.Use(app.AuthTokenMiddleware)
 
 			r.Post("/", app.createProductHandler)
+			r.Post("/bundles", app.createBundleHandler)
+			r.Get("/trending", app.getTrendingProductsHandler)
 
 			r.Route("/{productID}", func(r chi.Router) {
 				r.Use(app.productContextMiddleware)
 				r.Get("/", app.getProductHandler)
 
-				r.Patch("/", app.checkProductOwnership("seller", app.updateProductHandler))
+				r.Patch("/", app.checkProductOwnership("admin", app.updateProductHandler))
 				r.Delete("/", app.checkProductOwnership("admin", app.deleteProductHandler))
+
+				r.Post("/claim", app.claimProductHandler)
+
+				r.Put("/sale", app.checkProductOwnership("admin", app.updateProductSaleHandler))
+				r.Delete("/sale", app.checkProductOwnership("admin", app.endProductSaleHandler))
+
+				r.Get("/ratings", app.getProductRatingsHandler)
+				r.Get("/related", app.getRelatedProductsHandler)
+				r.Post("/reports", app.reportProductHandler)
+				r.Get("/reviews", app.listReviewsHandler)
+				r.Post("/reviews", app.createReviewHandler)
+				r.Patch("/reviews", app.updateReviewHandler)
+				r.Delete("/reviews", app.deleteReviewHandler)
+
+				r.Get("/plans", app.getSubscriptionPlansHandler)
+				r.Post("/plans", app.checkProductOwnership("admin", app.createSubscriptionPlanHandler))
+			})
+		})
+
+		r.Route("/orders", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getUserOrdersHandler)
+			r.Post("/", app.createOrderHandler)
+
+			r.Route("/{orderID}", func(r chi.Router) {
+				r.Use(app.orderContextMiddleware)
+				r.Get("/", app.getOrderHandler)
+				r.Get("/invoice.pdf", app.getOrderInvoiceHandler)
+			})
+		})
+
+		r.Route("/gifts", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getUserGiftsHandler)
+			r.Put("/redeem/{token}", app.redeemGiftHandler)
+
+			r.Route("/{giftID}", func(r chi.Router) {
+				r.Use(app.giftContextMiddleware)
+				r.Get("/", app.getGiftHandler)
+			})
+		})
+
+		r.Route("/reviews/{reviewID}", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.reviewContextMiddleware)
+
+			r.Post("/reports", app.reportReviewHandler)
+			r.Put("/vote", app.voteReviewHandler)
+			r.Delete("/vote", app.unvoteReviewHandler)
+			r.Put("/response", app.saveReviewResponseHandler)
+			r.Delete("/response", app.deleteReviewResponseHandler)
+		})
+
+		r.Route("/moderation", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/queue", app.checkRole("moderator", app.getModerationQueueHandler))
+			r.Patch("/reviews/{reviewID}", app.checkRole("moderator", app.moderateReviewHandler))
+			r.Get("/reports", app.checkRole("moderator", app.getReportsHandler))
+			r.Get("/actions", app.checkRole("moderator", app.getModerationActionsHandler))
+
+			// the role is checked before the report is loaded, so that its
+			// existence is not disclosed to users who cannot moderate
+			r.Patch("/reports/{reportID}", app.checkRole("moderator", app.reportContextMiddleware(http.HandlerFunc(app.resolveReportHandler)).ServeHTTP))
+		})
+
+		r.Route("/categories", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getCategoriesHandler)
+			r.Post("/", app.checkRole("admin", app.createCategoryHandler))
+
+			r.Route("/{categoryID}", func(r chi.Router) {
+				r.Use(app.categoryContextMiddleware)
+				r.Get("/", app.getCategoryHandler)
+				r.Patch("/", app.checkRole("admin", app.updateCategoryHandler))
+				r.Delete("/", app.checkRole("admin", app.deleteCategoryHandler))
+			})
+		})
+
+		r.Route("/tax/rules", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.checkRole("admin", app.getTaxRulesHandler))
+			r.Post("/", app.checkRole("admin", app.createTaxRuleHandler))
+
+			r.Route("/{ruleID}", func(r chi.Router) {
+				r.Use(app.taxRuleContextMiddleware)
+				r.Patch("/", app.checkRole("admin", app.updateTaxRuleHandler))
+				r.Delete("/", app.checkRole("admin", app.deleteTaxRuleHandler))
+			})
+		})
+
+		r.Route("/subscriptions", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getUserSubscriptionsHandler)
+			r.Post("/", app.createSubscriptionHandler)
+
+			r.Route("/{subscriptionID}", func(r chi.Router) {
+				r.Use(app.subscriptionContextMiddleware)
+				r.Delete("/", app.cancelSubscriptionHandler)
+			})
+		})
+
+		r.Route("/search", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/", app.searchHandler)
+			r.Get("/suggest", app.suggestHandler)
+		})
+
+		r.Route("/sellers/{slug}", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(app.OptionalAuthTokenMiddleware)
+				r.Use(app.sellerContextMiddleware)
+
+				r.Get("/", app.getSellerHandler)
+				r.Get("/products", app.getSellerProductsHandler)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.sellerContextMiddleware)
+
+				r.Put("/follow", app.followSellerHandler)
+				r.Delete("/follow", app.unfollowSellerHandler)
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
 
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/unsubscribe/{token}", app.unsubscribeHandler)
 
 			r.Route("/{userID}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 				r.Get("/", app.getUserHandler)
+
+				r.Post("/entitlements", app.checkRole("admin", app.grantEntitlementHandler))
+				r.Delete("/entitlements/{productID}", app.checkRole("admin", app.revokeEntitlementHandler))
 			})
 
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 				r.Get("/feed", app.getUserFeedHandler)
+				r.Get("/me/library", app.getUserLibraryHandler)
+				r.Get("/me/notifications", app.getNotificationPreferencesHandler)
+				r.Put("/me/notifications", app.updateNotificationPreferencesHandler)
+				r.Get("/me/billing-address", app.getBillingAddressHandler)
+				r.Put("/me/billing-address", app.updateBillingAddressHandler)
+				r.Get("/me/storefront", app.getStorefrontHandler)
+				r.Put("/me/storefront", app.updateStorefrontHandler)
 			})
 		})
 
 		r.Route("/wishlist", func(r chi.Router) {
+			r.Get("/shared/{slug}", app.getSharedWishlistHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Get("/", app.getWishlistHandler)
+
+				r.Route("/collections", func(r chi.Router) {
+					r.Get("/", app.getWishlistCollectionsHandler)
+					r.Post("/", app.createWishlistCollectionHandler)
+
+					r.Route("/{collectionID}", func(r chi.Router) {
+						r.Use(app.wishlistCollectionContextMiddleware)
+						r.Get("/", app.getWishlistCollectionHandler)
+						r.Patch("/", app.updateWishlistCollectionHandler)
+						r.Delete("/", app.deleteWishlistCollectionHandler)
+						r.Put("/share", app.shareWishlistCollectionHandler)
+						r.Delete("/share", app.unshareWishlistCollectionHandler)
+
+						r.Route("/products/{productID}", func(r chi.Router) {
+							r.Use(app.productContextMiddleware)
+							r.Put("/", app.addToWishlistCollectionHandler)
+							r.Delete("/", app.removeFromWishlistCollectionHandler)
+						})
+					})
+				})
+			})
+
 			r.Route("/{productID}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 				r.Use(app.productContextMiddleware)
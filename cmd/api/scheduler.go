@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/edwrdc/digitally/internal/mailer"
+	"github.com/edwrdc/digitally/internal/payment"
+	"github.com/edwrdc/digitally/internal/store"
+)
+
+const subscriptionBatchSize = 100
+
+// runSubscriptionScheduler periodically renews subscriptions whose period has
+// ended, retries failed renewals during the grace period and expires the ones
+// that were canceled or could not be paid for.
+func (app *application) runSubscriptionScheduler(ctx context.Context) {
+	ticker := time.NewTicker(app.config.subs.schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.processDueSubscriptions(ctx)
+		}
+	}
+}
+
+func (app *application) processDueSubscriptions(ctx context.Context) {
+	now := time.Now().UTC()
+
+	subs, err := app.store.Subscriptions.GetDue(ctx, now, subscriptionBatchSize)
+	if err != nil {
+		app.logger.Errorw("Failed to fetch due subscriptions", "error", err)
+		return
+	}
+
+	for i := range subs {
+		if err := app.processSubscription(ctx, subs[i].ID, now); err != nil {
+			app.logger.Errorw("Failed to process subscription", "subscription", subs[i].ID, "error", err)
+		}
+	}
+}
+
+// processSubscription renews or expires the subscription while it is locked,
+// so it is charged at most once even when its user cancels it meanwhile or
+// other instances run the scheduler too. One that stopped being due since it
+// was fetched is left alone.
+func (app *application) processSubscription(ctx context.Context, subscriptionID int64, now time.Time) error {
+	var dunning bool
+	sub, err := app.store.Subscriptions.ProcessDue(ctx, subscriptionID, now, func(sub *store.Subscription) {
+		dunning = app.renewSubscription(ctx, sub, now)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if dunning {
+		app.sendDunningEmail(ctx, sub)
+	}
+
+	return nil
+}
+
+// renewSubscription charges the next period of the subscription, or expires
+// it once canceled or past its grace period, and reports whether its user
+// should be told that the payment failed.
+func (app *application) renewSubscription(ctx context.Context, sub *store.Subscription, now time.Time) bool {
+	switch sub.Status {
+	case store.SubscriptionStatusCanceled:
+		sub.Status = store.SubscriptionStatusExpired
+		return false
+	case store.SubscriptionStatusPastDue:
+		if sub.GraceUntil != nil && !now.Before(*sub.GraceUntil) {
+			sub.Status = store.SubscriptionStatusExpired
+			return true
+		}
+	}
+
+	ref, err := app.payments.Charge(ctx, payment.Charge{
+		CustomerID:     sub.UserID,
+		Amount:         sub.Plan.Price,
+		Description:    sub.Plan.Name,
+		IdempotencyKey: fmt.Sprintf("subscription-%d-%d", sub.ID, sub.CurrentPeriodEnd.Unix()),
+	})
+	if err != nil {
+		app.logger.Warnw("Subscription renewal failed", "subscription", sub.ID, "error", err)
+
+		if sub.Status != store.SubscriptionStatusPastDue {
+			graceUntil := sub.CurrentPeriodEnd.Add(app.config.subs.gracePeriod)
+			sub.Status = store.SubscriptionStatusPastDue
+			sub.GraceUntil = &graceUntil
+		}
+
+		sub.FailedAttempts++
+		sub.NextAttemptAt = now.Add(app.config.subs.retryInterval)
+		if sub.NextAttemptAt.After(*sub.GraceUntil) {
+			sub.NextAttemptAt = *sub.GraceUntil
+		}
+
+		return true
+	}
+
+	// the new period follows on from the previous one, even when it was paid
+	// late during the grace period
+	sub.CurrentPeriodStart = sub.CurrentPeriodEnd
+	sub.CurrentPeriodEnd = sub.Plan.NextPeriodEnd(sub.CurrentPeriodStart)
+	sub.Status = store.SubscriptionStatusActive
+	sub.GraceUntil = nil
+	sub.FailedAttempts = 0
+	sub.NextAttemptAt = sub.CurrentPeriodEnd
+	sub.PaymentReference = ref
+
+	return false
+}
+
+func (app *application) sendDunningEmail(ctx context.Context, sub *store.Subscription) {
+	user, err := app.store.Users.GetByID(ctx, sub.UserID)
+	if err != nil {
+		app.logger.Errorw("Failed to load user for dunning email", "subscription", sub.ID, "error", err)
+		return
+	}
+
+	product, err := app.store.Products.GetByID(ctx, sub.Plan.ProductID)
+	if err != nil {
+		app.logger.Errorw("Failed to load product for dunning email", "subscription", sub.ID, "error", err)
+		return
+	}
+
+	vars := struct {
+		Username    string
+		PlanName    string
+		ProductName string
+		Amount      string
+		GraceUntil  string
+		Expired     bool
+		ManageURL   string
+	}{
+		Username:    user.Username,
+		PlanName:    sub.Plan.Name,
+		ProductName: product.Name,
+		Amount:      fmt.Sprintf("%.2f", sub.Plan.Price),
+		Expired:     sub.Status == store.SubscriptionStatusExpired,
+		ManageURL:   fmt.Sprintf("%s/account/subscriptions", app.config.frontendURL),
+	}
+
+	if sub.GraceUntil != nil {
+		vars.GraceUntil = sub.GraceUntil.Format("January 2, 2006")
+	}
+
+	isProdEnv := app.config.env == "production"
+
+	statusCode, err := app.mailer.Send(mailer.SubscriptionPaymentFailedTemplate, user.Username, user.Email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Errorw("Failed to send dunning email", "subscription", sub.ID, "error", err)
+		return
+	}
+
+	app.logger.Infow("Dunning email sent", "subscription", sub.ID, "status code", statusCode)
+}
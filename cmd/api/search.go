@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/edwrdc/digitally/internal/search"
+	"github.com/edwrdc/digitally/internal/store"
+)
+
+// SearchResults are a page of the products matching a search. The facets count
+// all of them and come with the first page only, as they don't change while
+// paging.
+type SearchResults struct {
+	Data       []store.UserFeedProduct `json:"data"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+	PrevCursor string                  `json:"prev_cursor,omitempty"`
+	Facets     *store.SearchFacets     `json:"facets,omitempty"`
+}
+
+// Search godoc
+//
+//	@Summary		Search products
+//	@Description	Searches the products, most relevant first, and counts the matches by category, type, seller and price range. Without search terms, it browses the latest products
+//	@Tags			products
+//	@Produce		json
+//	@Param			search		query		string	false	"Search terms, supporting quoted phrases, OR and -excluded words. Matches are highlighted"
+//	@Param			limit		query		int		false	"Number of items per page"	default(20)
+//	@Param			cursor		query		string	false	"Cursor of the page to get"
+//	@Param			sort		query		string	false	"Sort order (asc/desc), rating for the best rated first, recommended, or relevance to the search"	default(relevance)
+//	@Param			sort_by		query		string	false	"Field to sort by (newest/price/rating/wishlisted/best_selling), in the sort order: asc or desc, by default the cheapest first for the price and the highest first otherwise"
+//	@Param			categories	query		string	false	"Comma separated category slugs, matching any of them or their subcategories"
+//	@Param			min_rating	query		number	false	"Minimum average rating (0-5)"
+//	@Param			min_price	query		number	false	"Minimum price"
+//	@Param			max_price	query		number	false	"Maximum price"
+//	@Param			seller		query		string	false	"Username of the seller"
+//	@Param			type		query		string	false	"Product type (file/service/item)"
+//	@Param			following	query		bool	false	"Only the products of the sellers the user follows"
+//	@Success		200			{object}	SearchResults
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/search [get]
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readFeedQuery(w, r, store.SortByRelevance)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.matchSearch(ctx, &fq); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	page, err := app.store.Products.GetUserFeed(ctx, user.ID, fq, app.config.feed.ranking)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	results := SearchResults{
+		Data:       page.Items,
+		NextCursor: app.cursors.Encode(page.Next),
+		PrevCursor: app.cursors.Encode(page.Prev),
+	}
+
+	if fq.Cursor == nil {
+		results.Facets, err = app.store.Products.GetSearchFacets(ctx, user.ID, fq)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Suggest godoc
+//
+//	@Summary		Suggest searches
+//	@Description	Suggests product names, categories and sellers for a search being typed, starting with it or close to it. Categories are weighed by popularity. Suggestions taking too long are left out rather than holding up the search box
+//	@Tags			products
+//	@Produce		json
+//	@Param			q	query		string	true	"Search typed so far"
+//	@Success		200	{object}	store.SearchSuggestions
+//	@Failure		400	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/search/suggest [get]
+func (app *application) suggestHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.ToLower(strings.Join(strings.Fields(r.URL.Query().Get("q")), " "))
+	if err := Validate.Var(prefix, "required,max=100"); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.config.suggest.budget)
+	defer cancel()
+
+	suggestions, err := app.getSuggestions(ctx, prefix)
+	if err != nil {
+		if ctx.Err() == nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.logger.Warnw("Suggestions over budget", "prefix", prefix, "error", err)
+		suggestions = &store.SearchSuggestions{
+			Products:   make([]store.ProductSuggestion, 0),
+			Categories: make([]store.CategorySuggestion, 0),
+			Sellers:    make([]store.SellerSuggestion, 0),
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, suggestions); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getSuggestions returns the suggestions for the prefix, from the cache when
+// it is hot. The cache failing falls back to the database.
+func (app *application) getSuggestions(ctx context.Context, prefix string) (*store.SearchSuggestions, error) {
+	if !app.config.redisCfg.enabled {
+		return app.store.Products.GetSuggestions(ctx, prefix, app.config.suggest.limit, app.config.suggest.popularityWeight)
+	}
+
+	suggestions, err := app.cacheStorage.Suggestions.Get(ctx, prefix)
+	if err != nil {
+		app.logger.Warnw("Failed to get cached suggestions", "prefix", prefix, "error", err)
+	}
+	if suggestions != nil {
+		return suggestions, nil
+	}
+
+	suggestions, err = app.store.Products.GetSuggestions(ctx, prefix, app.config.suggest.limit, app.config.suggest.popularityWeight)
+	if err != nil {
+		return nil, err
+	}
+
+	hits, err := app.cacheStorage.Suggestions.Hit(ctx, prefix)
+	if err != nil {
+		app.logger.Warnw("Failed to count suggestion hit", "prefix", prefix, "error", err)
+		return suggestions, nil
+	}
+
+	if hits >= app.config.suggest.hotPrefixHits {
+		if err := app.cacheStorage.Suggestions.Set(ctx, prefix, suggestions); err != nil {
+			app.logger.Warnw("Failed to cache suggestions", "prefix", prefix, "error", err)
+		}
+	}
+
+	return suggestions, nil
+}
+
+// matchSearch looks the query's search up in the search index, if enabled,
+// leaving Postgres to filter and page what it matched. Only the best matches
+// are kept.
+func (app *application) matchSearch(ctx context.Context, fq *store.PaginationFeedQuery) error {
+	if app.searchIndex == nil || fq.Search == "" {
+		return nil
+	}
+
+	hits, err := app.searchIndex.Search(ctx, fq.Search, app.config.search.maxMatches)
+	if err != nil {
+		return err
+	}
+
+	matches := &store.SearchMatches{
+		IDs:    make([]int64, len(hits)),
+		Scores: make([]float64, len(hits)),
+	}
+	for i, hit := range hits {
+		matches.IDs[i] = hit.ID
+		matches.Scores[i] = hit.Score
+	}
+	fq.Matches = matches
+
+	return nil
+}
+
+// indexProduct brings the product up to date in the search index, if enabled.
+// A failure leaves the index behind rather than failing the request, until the
+// next reindex.
+func (app *application) indexProduct(ctx context.Context, product *store.Product) {
+	if app.searchIndex == nil {
+		return
+	}
+
+	if err := app.searchIndex.Index(ctx, search.NewDocument(product)); err != nil {
+		app.logger.Errorw("Failed to index product", "product", product.ID, "error", err)
+	}
+}
+
+// reindexProducts brings the products changed in the database up to date in
+// the search index, if enabled, loading them again first.
+func (app *application) reindexProducts(ctx context.Context, productIDs []int64) {
+	if app.searchIndex == nil {
+		return
+	}
+
+	for _, id := range productIDs {
+		product, err := app.store.Products.GetByID(ctx, id)
+		if err != nil {
+			app.logger.Errorw("Failed to load product to index", "product", id, "error", err)
+			continue
+		}
+
+		app.indexProduct(ctx, product)
+	}
+}
+
+// unindexProduct removes the deleted product from the search index, if
+// enabled.
+func (app *application) unindexProduct(ctx context.Context, productID int64) {
+	if app.searchIndex == nil {
+		return
+	}
+
+	if err := app.searchIndex.Delete(ctx, productID); err != nil {
+		app.logger.Errorw("Failed to remove product from search index", "product", productID, "error", err)
+	}
+}
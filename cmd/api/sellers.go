@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type sellerKey string
+
+const sellerCtx sellerKey = "seller"
+
+// GetSeller godoc
+//
+//	@Summary		Get a seller
+//	@Description	Retrieves the public profile of a seller by their storefront slug: the storefront, product and follower counts, average rating of their products and join date, and whether the current user, if signed in, follows them
+//	@Tags			sellers
+//	@Produce		json
+//	@Param			slug	path		string	true	"Storefront slug"
+//	@Success		200		{object}	store.Seller
+//	@Failure		401		{object}	error	"Invalid token"
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/sellers/{slug} [get]
+func (app *application) getSellerHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getSellerFromContext(r)); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetSellerProducts godoc
+//
+//	@Summary		List a seller's products
+//	@Description	Retrieves a paginated listing of a seller's products, with the filters and sorts of the feed. Signing in is optional, anonymous visitors own, wishlist and follow nothing
+//	@Tags			sellers
+//	@Produce		json
+//	@Param			slug		path		string	true	"Storefront slug"
+//	@Param			limit		query		int		false	"Number of items per page"	default(20)
+//	@Param			cursor		query		string	false	"Cursor of the page to get"
+//	@Param			sort		query		string	false	"Sort order (asc/desc), rating for the best rated first, recommended, or relevance to the search"	default(desc)
+//	@Param			sort_by		query		string	false	"Field to sort by (newest/price/rating/wishlisted/best_selling), in the sort order: asc or desc, by default the cheapest first for the price and the highest first otherwise"
+//	@Param			categories	query		string	false	"Comma separated category slugs, matching any of them or their subcategories"
+//	@Param			search		query		string	false	"Search terms, supporting quoted phrases, OR and -excluded words. Matches are highlighted"
+//	@Param			min_rating	query		number	false	"Minimum average rating (0-5)"
+//	@Param			min_price	query		number	false	"Minimum price"
+//	@Param			max_price	query		number	false	"Maximum price"
+//	@Param			type		query		string	false	"Product type (file/service/item)"
+//	@Param			following	query		bool	false	"Only the products of the sellers the user follows"
+//	@Success		200			{object}	CursorPage[store.UserFeedProduct]
+//	@Failure		401			{object}	error	"Invalid token"
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/sellers/{slug}/products [get]
+func (app *application) getSellerProductsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readFeedQuery(w, r, "desc")
+	if !ok {
+		return
+	}
+
+	seller := getSellerFromContext(r)
+	fq.Seller = seller.Username
+
+	ctx := r.Context()
+
+	if err := app.matchSearch(ctx, &fq); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	products, err := app.store.Products.GetUserFeed(ctx, getViewerIDFromContext(r), fq, app.config.feed.ranking)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, newCursorPage(app.cursors, products)); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// FollowSeller godoc
+//
+//	@Summary		Follow a seller
+//	@Description	Makes the current user a follower of the seller, getting their new products in the following feed and digest emails. Following a seller again has no effect
+//	@Tags			sellers
+//	@Produce		json
+//	@Param			slug	path		string	true	"Storefront slug"
+//	@Success		204		{object}	nil
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/sellers/{slug}/follow [put]
+func (app *application) followSellerHandler(w http.ResponseWriter, r *http.Request) {
+	seller := getSellerFromContext(r)
+	user := getUserFromContext(r)
+
+	if seller.ID == user.ID {
+		app.badRequestResponse(w, r, errors.New("you cannot follow yourself"))
+		return
+	}
+
+	if err := app.store.Sellers.Follow(r.Context(), user.ID, seller.ID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnfollowSeller godoc
+//
+//	@Summary		Unfollow a seller
+//	@Description	Stops the current user following the seller
+//	@Tags			sellers
+//	@Produce		json
+//	@Param			slug	path		string	true	"Storefront slug"
+//	@Success		204		{object}	nil
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/sellers/{slug}/follow [delete]
+func (app *application) unfollowSellerHandler(w http.ResponseWriter, r *http.Request) {
+	seller := getSellerFromContext(r)
+	user := getUserFromContext(r)
+
+	if err := app.store.Sellers.Unfollow(r.Context(), user.ID, seller.ID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) sellerContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		seller, err := app.store.Sellers.GetBySlug(ctx, chi.URLParam(r, "slug"), getViewerIDFromContext(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, sellerCtx, seller)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getSellerFromContext(r *http.Request) *store.Seller {
+	return r.Context().Value(sellerCtx).(*store.Seller)
+}
+
+// GetStorefront godoc
+//
+//	@Summary		Get the current user's storefront
+//	@Description	Retrieves the storefront the current user presents themselves with as a seller
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	store.Storefront
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/storefront [get]
+func (app *application) getStorefrontHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	storefront, err := app.store.Sellers.GetStorefront(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, storefront); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// numberedSlugPattern matches the slugs ending in a number, which are left for
+// the storefronts whose slug taken from the username was already taken.
+var numberedSlugPattern = regexp.MustCompile(`-[0-9]+$`)
+
+type StorefrontPayload struct {
+	Slug      string   `json:"slug" validate:"required,max=100,slug"`
+	BannerURL string   `json:"banner_url" validate:"omitempty,max=2048,http_url"`
+	About     string   `json:"about" validate:"max=2000"`
+	Links     []string `json:"links" validate:"max=5,dive,max=2048,http_url"`
+}
+
+// UpdateStorefront godoc
+//
+//	@Summary		Set the current user's storefront
+//	@Description	Replaces the storefront's slug, banner, about text and links. The slug is the storefront's URL, unique among sellers, and cannot be changed to one ending in a number
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		StorefrontPayload	true	"Storefront"
+//	@Success		200		{object}	store.Storefront
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"Another seller has this slug"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/storefront [put]
+func (app *application) updateStorefrontHandler(w http.ResponseWriter, r *http.Request) {
+	var payload StorefrontPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	// a storefront may keep the numbered slug it was given
+	if numberedSlugPattern.MatchString(payload.Slug) {
+		current, err := app.store.Sellers.GetStorefront(ctx, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if current.Slug != payload.Slug {
+			app.badRequestResponse(w, r, errors.New("slug cannot end in a number"))
+			return
+		}
+	}
+
+	storefront := &store.Storefront{
+		UserID:    user.ID,
+		Slug:      payload.Slug,
+		BannerURL: payload.BannerURL,
+		About:     payload.About,
+		Links:     payload.Links,
+	}
+
+	if storefront.Links == nil {
+		storefront.Links = []string{}
+	}
+
+	if err := app.store.Sellers.UpdateStorefront(ctx, storefront); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, storefront); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
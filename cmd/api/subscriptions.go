@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/edwrdc/digitally/internal/payment"
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type subscriptionKey string
+
+const subscriptionCtx subscriptionKey = "subscription"
+
+type CreateSubscriptionPlanPayload struct {
+	Name          string  `json:"name" validate:"required,max=100"`
+	Price         float64 `json:"price" validate:"required,number,gt=0"`
+	Interval      string  `json:"interval" validate:"required,oneof=day week month year"`
+	IntervalCount int     `json:"interval_count" validate:"omitempty,gte=1,lte=12"`
+	TrialDays     int     `json:"trial_days" validate:"omitempty,gte=0,lte=90"`
+}
+
+// CreateSubscriptionPlan godoc
+//
+//	@Summary		Create a subscription plan
+//	@Description	Adds a recurring billing plan to a product
+//	@Tags			subscriptions
+//	@Accept			json
+//	@Produce		json
+//	@Param			productID	path		int								true	"Product ID"
+//	@Param			request		body		CreateSubscriptionPlanPayload	true	"Plan details"
+//	@Success		201			{object}	store.SubscriptionPlan
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/plans [post]
+func (app *application) createSubscriptionPlanHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateSubscriptionPlanPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	product := getProductFromContext(r)
+
+	plan := &store.SubscriptionPlan{
+		ProductID:     product.ID,
+		Name:          payload.Name,
+		Price:         payload.Price,
+		Interval:      store.BillingInterval(payload.Interval),
+		IntervalCount: payload.IntervalCount,
+		TrialDays:     payload.TrialDays,
+	}
+
+	if plan.IntervalCount == 0 {
+		plan.IntervalCount = 1
+	}
+
+	if err := app.store.Subscriptions.CreatePlan(r.Context(), plan); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, plan); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetSubscriptionPlans godoc
+//
+//	@Summary		List subscription plans
+//	@Description	Lists the active subscription plans of a product
+//	@Tags			subscriptions
+//	@Produce		json
+//	@Param			productID	path		int	true	"Product ID"
+//	@Success		200			{array}		store.SubscriptionPlan
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/products/{productID}/plans [get]
+func (app *application) getSubscriptionPlansHandler(w http.ResponseWriter, r *http.Request) {
+	product := getProductFromContext(r)
+
+	plans, err := app.store.Subscriptions.GetPlansByProductID(r.Context(), product.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, plans); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type CreateSubscriptionPayload struct {
+	PlanID int64 `json:"plan_id" validate:"required,gt=0"`
+}
+
+// CreateSubscription godoc
+//
+//	@Summary		Subscribe to a plan
+//	@Description	Starts a subscription, beginning with the plan's trial when it has one
+//	@Tags			subscriptions
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateSubscriptionPayload	true	"Plan to subscribe to"
+//	@Success		201		{object}	store.Subscription
+//	@Failure		400		{object}	error
+//	@Failure		402		{object}	error	"Payment declined"
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"Already subscribed"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/subscriptions [post]
+func (app *application) createSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateSubscriptionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	plan, err := app.store.Subscriptions.GetPlanByID(ctx, payload.PlanID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !plan.Active {
+		app.notFoundResponse(w, r, fmt.Errorf("plan %d is no longer offered", plan.ID))
+		return
+	}
+
+	existing, err := app.store.Subscriptions.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, sub := range existing {
+		if sub.PlanID == plan.ID && sub.Status != store.SubscriptionStatusExpired {
+			app.conflictResponse(w, r, errors.New("already subscribed to this plan"))
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+
+	sub := &store.Subscription{
+		UserID:             user.ID,
+		PlanID:             plan.ID,
+		Plan:               *plan,
+		CurrentPeriodStart: now,
+	}
+
+	if plan.TrialDays > 0 {
+		trialEnd := now.AddDate(0, 0, plan.TrialDays)
+		sub.Status = store.SubscriptionStatusTrialing
+		sub.TrialEndsAt = &trialEnd
+		sub.CurrentPeriodEnd = trialEnd
+	} else {
+		ref, err := app.payments.Charge(ctx, payment.Charge{
+			CustomerID:     user.ID,
+			Amount:         plan.Price,
+			Description:    plan.Name,
+			IdempotencyKey: fmt.Sprintf("subscription-%d-%d-%d", user.ID, plan.ID, now.Unix()),
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, payment.ErrDeclined):
+				app.paymentRequiredResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		sub.Status = store.SubscriptionStatusActive
+		sub.CurrentPeriodEnd = plan.NextPeriodEnd(now)
+		sub.PaymentReference = ref
+	}
+
+	sub.NextAttemptAt = sub.CurrentPeriodEnd
+
+	if err := app.store.Subscriptions.Create(ctx, sub); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, sub); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetUserSubscriptions godoc
+//
+//	@Summary		List the current user's subscriptions
+//	@Description	Lists every subscription of the current user, including ended ones
+//	@Tags			subscriptions
+//	@Produce		json
+//	@Success		200	{array}		store.Subscription
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/subscriptions [get]
+func (app *application) getUserSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	subs, err := app.store.Subscriptions.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, subs); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// CancelSubscription godoc
+//
+//	@Summary		Cancel a subscription
+//	@Description	Cancels a subscription. Access is kept until the end of the paid period.
+//	@Tags			subscriptions
+//	@Produce		json
+//	@Param			subscriptionID	path		int	true	"Subscription ID"
+//	@Success		200				{object}	store.Subscription
+//	@Failure		404				{object}	error
+//	@Failure		409				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/subscriptions/{subscriptionID} [delete]
+func (app *application) cancelSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	sub := getSubscriptionFromContext(r)
+
+	now := time.Now().UTC()
+
+	switch sub.Status {
+	case store.SubscriptionStatusCanceled, store.SubscriptionStatusExpired:
+		app.conflictResponse(w, r, fmt.Errorf("subscription is already %s", sub.Status))
+		return
+	case store.SubscriptionStatusPastDue:
+		// nothing has been paid for the current period, so access ends right away
+		sub.Status = store.SubscriptionStatusExpired
+	default:
+		sub.Status = store.SubscriptionStatusCanceled
+		sub.NextAttemptAt = sub.CurrentPeriodEnd
+	}
+	sub.CanceledAt = &now
+
+	if err := app.store.Subscriptions.Update(r.Context(), sub); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, sub); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) subscriptionContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "subscriptionID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		sub, err := app.store.Subscriptions.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// other users' subscriptions are reported as missing rather than forbidden
+		if sub.UserID != getUserFromContext(r).ID {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, subscriptionCtx, sub)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getSubscriptionFromContext(r *http.Request) *store.Subscription {
+	return r.Context().Value(subscriptionCtx).(*store.Subscription)
+}
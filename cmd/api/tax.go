@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/edwrdc/digitally/internal/tax"
+	"github.com/go-chi/chi/v5"
+)
+
+type taxRuleKey string
+
+const taxRuleCtx taxRuleKey = "taxRule"
+
+const dateLayout = "2006-01-02"
+
+type CreateTaxRulePayload struct {
+	Country     string   `json:"country" validate:"required,len=2,alpha"`
+	ProductType *string  `json:"product_type" validate:"omitempty,oneof=file service item"`
+	Name        string   `json:"name" validate:"omitempty,max=50"`
+	Rate        *float64 `json:"rate" validate:"required,gte=0,lt=1"`
+	ValidFrom   string   `json:"valid_from" validate:"omitempty,datetime=2006-01-02"`
+	ValidUntil  *string  `json:"valid_until" validate:"omitempty,datetime=2006-01-02"`
+}
+
+// GetTaxRules godoc
+//
+//	@Summary		List tax rules
+//	@Description	Lists the tax rules, optionally for a single country
+//	@Tags			tax
+//	@Produce		json
+//	@Param			country	query		string	false	"ISO 3166-1 alpha-2 country code"
+//	@Success		200		{array}		store.TaxRule
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tax/rules [get]
+func (app *application) getTaxRulesHandler(w http.ResponseWriter, r *http.Request) {
+	country := strings.ToUpper(r.URL.Query().Get("country"))
+
+	rules, err := app.store.TaxRules.List(r.Context(), country)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, rules); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// CreateTaxRule godoc
+//
+//	@Summary		Create a tax rule
+//	@Description	Adds the rate charged on a product type in a country from a given date
+//	@Tags			tax
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateTaxRulePayload	true	"Tax rule"
+//	@Success		201		{object}	store.TaxRule
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		409		{object}	error	"A rule for this country, type and date already exists"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tax/rules [post]
+func (app *application) createTaxRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateTaxRulePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	rule := &store.TaxRule{
+		Country:     strings.ToUpper(payload.Country),
+		ProductType: payload.ProductType,
+		Name:        payload.Name,
+		Rate:        *payload.Rate,
+		ValidFrom:   time.Now().UTC().Truncate(24 * time.Hour),
+	}
+
+	if rule.Name == "" {
+		rule.Name = "VAT"
+	}
+
+	if payload.ValidFrom != "" {
+		rule.ValidFrom, _ = time.Parse(dateLayout, payload.ValidFrom)
+	}
+
+	if payload.ValidUntil != nil {
+		validUntil, _ := time.Parse(dateLayout, *payload.ValidUntil)
+		rule.ValidUntil = &validUntil
+	}
+
+	if rule.ValidUntil != nil && rule.ValidUntil.Before(rule.ValidFrom) {
+		app.badRequestResponse(w, r, errors.New("valid_until must not be before valid_from"))
+		return
+	}
+
+	if err := app.store.TaxRules.Create(r.Context(), rule); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, rule); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type UpdateTaxRulePayload struct {
+	Name       *string  `json:"name" validate:"omitempty,min=1,max=50"`
+	Rate       *float64 `json:"rate" validate:"omitempty,gte=0,lt=1"`
+	ValidFrom  *string  `json:"valid_from" validate:"omitempty,datetime=2006-01-02"`
+	ValidUntil *string  `json:"valid_until" validate:"omitempty,datetime=2006-01-02"`
+}
+
+// UpdateTaxRule godoc
+//
+//	@Summary		Update a tax rule
+//	@Description	Changes the name, rate or validity of a tax rule
+//	@Tags			tax
+//	@Accept			json
+//	@Produce		json
+//	@Param			ruleID	path		int						true	"Tax rule ID"
+//	@Param			request	body		UpdateTaxRulePayload	true	"Tax rule details to update"
+//	@Success		200		{object}	store.TaxRule
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"A rule for this country, type and date already exists"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tax/rules/{ruleID} [patch]
+func (app *application) updateTaxRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule := getTaxRuleFromContext(r)
+
+	var payload UpdateTaxRulePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.Name != nil {
+		rule.Name = *payload.Name
+	}
+
+	if payload.Rate != nil {
+		rule.Rate = *payload.Rate
+	}
+
+	if payload.ValidFrom != nil {
+		rule.ValidFrom, _ = time.Parse(dateLayout, *payload.ValidFrom)
+	}
+
+	if payload.ValidUntil != nil {
+		validUntil, _ := time.Parse(dateLayout, *payload.ValidUntil)
+		rule.ValidUntil = &validUntil
+	}
+
+	if rule.ValidUntil != nil && rule.ValidUntil.Before(rule.ValidFrom) {
+		app.badRequestResponse(w, r, errors.New("valid_until must not be before valid_from"))
+		return
+	}
+
+	if err := app.store.TaxRules.Update(r.Context(), rule); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, rule); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteTaxRule godoc
+//
+//	@Summary		Delete a tax rule
+//	@Description	Deletes a tax rule. Past orders keep the tax lines they were charged
+//	@Tags			tax
+//	@Produce		json
+//	@Param			ruleID	path		int	true	"Tax rule ID"
+//	@Success		204		{object}	nil
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tax/rules/{ruleID} [delete]
+func (app *application) deleteTaxRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule := getTaxRuleFromContext(r)
+
+	if err := app.store.TaxRules.Delete(r.Context(), rule.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) taxRuleContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "ruleID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		rule, err := app.store.TaxRules.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, taxRuleCtx, rule)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getTaxRuleFromContext(r *http.Request) *store.TaxRule {
+	return r.Context().Value(taxRuleCtx).(*store.TaxRule)
+}
+
+// GetBillingAddress godoc
+//
+//	@Summary		Get the current user's billing address
+//	@Description	Retrieves the billing address used to work out the tax on purchases
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	store.BillingAddress
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/billing-address [get]
+func (app *application) getBillingAddressHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	address, err := app.store.BillingAddresses.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, address); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type BillingAddressPayload struct {
+	Name       string `json:"name" validate:"required,max=255"`
+	Line1      string `json:"line1" validate:"required,max=255"`
+	Line2      string `json:"line2" validate:"max=255"`
+	City       string `json:"city" validate:"required,max=100"`
+	PostalCode string `json:"postal_code" validate:"max=20"`
+	Country    string `json:"country" validate:"required,len=2,alpha"`
+	VATID      string `json:"vat_id" validate:"max=20"`
+}
+
+// UpdateBillingAddress godoc
+//
+//	@Summary		Set the current user's billing address
+//	@Description	Creates or replaces the billing address. A business VAT ID must be valid for the country
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		BillingAddressPayload	true	"Billing address"
+//	@Success		200		{object}	store.BillingAddress
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/billing-address [put]
+func (app *application) updateBillingAddressHandler(w http.ResponseWriter, r *http.Request) {
+	var payload BillingAddressPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	address := &store.BillingAddress{
+		UserID:     user.ID,
+		Name:       payload.Name,
+		Line1:      payload.Line1,
+		Line2:      payload.Line2,
+		City:       payload.City,
+		PostalCode: payload.PostalCode,
+		Country:    strings.ToUpper(payload.Country),
+		VATID:      strings.ToUpper(strings.TrimSpace(payload.VATID)),
+	}
+
+	if address.VATID != "" {
+		if err := app.tax.CheckVATID(ctx, address.Country, address.VATID); err != nil {
+			switch {
+			case errors.Is(err, tax.ErrInvalidVATID):
+				app.badRequestResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	if err := app.store.BillingAddresses.Upsert(ctx, address); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, address); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -84,6 +84,16 @@ func getUserFromContext(r *http.Request) *store.User {
 	return user
 }
 
+// getViewerIDFromContext returns the ID of the user behind a request that may
+// be anonymous, or 0 when it is.
+func getViewerIDFromContext(r *http.Request) int64 {
+	user, ok := r.Context().Value(userCtx).(*store.User)
+	if !ok {
+		return 0
+	}
+	return user.ID
+}
+
 // ActivateUser godoc
 //
 //	@Summary		Activates/Register a user
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
 // AddToWishlist godoc
@@ -77,3 +83,420 @@ func (app *application) removeProductFromWishlistHandler(w http.ResponseWriter,
 		return
 	}
 }
+
+type wishlistCollectionKey string
+
+const wishlistCollectionCtx wishlistCollectionKey = "wishlistCollection"
+
+type WishlistCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// SharedWishlist is the read-only view of a shared collection.
+type SharedWishlist struct {
+	Collection store.WishlistCollection       `json:"collection"`
+	Products   CursorPage[store.WishlistItem] `json:"products"`
+}
+
+// GetWishlist godoc
+//
+//	@Summary		Get the wishlist
+//	@Description	Lists the products in the current user's wishlist, latest additions first
+//	@Tags			wishlist
+//	@Produce		json
+//	@Param			limit	query		int		false	"Number of items per page"								default(20)
+//	@Param			offset	query		int		false	"Offset for pagination, ignored when a cursor is given"	default(0)
+//	@Param			cursor	query		string	false	"Cursor of the page to get"
+//	@Success		200		{object}	CursorPage[store.WishlistItem]
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist [get]
+func (app *application) getWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readListingPage(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := app.store.Wishlist.GetByUserID(r.Context(), getUserFromContext(r).ID, fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, newCursorPage(app.cursors, items)); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetWishlistCollections godoc
+//
+//	@Summary		List wishlist collections
+//	@Description	Lists the current user's wishlist collections
+//	@Tags			wishlist
+//	@Produce		json
+//	@Success		200	{array}		store.WishlistCollection
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist/collections [get]
+func (app *application) getWishlistCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	collections, err := app.store.Wishlist.GetCollections(r.Context(), getUserFromContext(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// CreateWishlistCollection godoc
+//
+//	@Summary		Create a wishlist collection
+//	@Description	Adds a named collection to organize the current user's wishlist
+//	@Tags			wishlist
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		WishlistCollectionPayload	true	"Collection"
+//	@Success		201		{object}	store.WishlistCollection
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error	"A collection with this name already exists"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist/collections [post]
+func (app *application) createWishlistCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload WishlistCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	collection := &store.WishlistCollection{
+		UserID:        user.ID,
+		Name:          payload.Name,
+		OwnerUsername: user.Username,
+	}
+
+	if err := app.store.Wishlist.CreateCollection(r.Context(), collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, collection); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetWishlistCollection godoc
+//
+//	@Summary		Get a wishlist collection
+//	@Description	Retrieves one of the current user's collections and a page of its products
+//	@Tags			wishlist
+//	@Produce		json
+//	@Param			collectionID	path		int		true	"Collection ID"
+//	@Param			limit			query		int		false	"Number of items per page"								default(20)
+//	@Param			offset			query		int		false	"Offset for pagination, ignored when a cursor is given"	default(0)
+//	@Param			cursor			query		string	false	"Cursor of the page to get"
+//	@Success		200				{object}	SharedWishlist
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist/collections/{collectionID} [get]
+func (app *application) getWishlistCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeWishlistCollection(w, r, getWishlistCollectionFromContext(r))
+}
+
+// UpdateWishlistCollection godoc
+//
+//	@Summary		Rename a wishlist collection
+//	@Description	Renames one of the current user's collections
+//	@Tags			wishlist
+//	@Accept			json
+//	@Produce		json
+//	@Param			collectionID	path		int							true	"Collection ID"
+//	@Param			request			body		WishlistCollectionPayload	true	"Collection"
+//	@Success		200				{object}	store.WishlistCollection
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		409				{object}	error	"A collection with this name already exists"
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist/collections/{collectionID} [patch]
+func (app *application) updateWishlistCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload WishlistCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := getWishlistCollectionFromContext(r)
+	collection.Name = payload.Name
+
+	app.saveWishlistCollection(w, r, collection)
+}
+
+// DeleteWishlistCollection godoc
+//
+//	@Summary		Delete a wishlist collection
+//	@Description	Deletes one of the current user's collections. Its products stay in the wishlist
+//	@Tags			wishlist
+//	@Produce		json
+//	@Param			collectionID	path		int	true	"Collection ID"
+//	@Success		204				{object}	nil
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist/collections/{collectionID} [delete]
+func (app *application) deleteWishlistCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getWishlistCollectionFromContext(r)
+
+	if err := app.store.Wishlist.DeleteCollection(r.Context(), collection.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddToWishlistCollection godoc
+//
+//	@Summary		Add a product to a wishlist collection
+//	@Description	Puts a product in one of the current user's collections, adding it to the wishlist if needed
+//	@Tags			wishlist
+//	@Produce		json
+//	@Param			collectionID	path		int	true	"Collection ID"
+//	@Param			productID		path		int	true	"Product ID"
+//	@Success		204				{object}	nil
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error	"Collection or product not found"
+//	@Failure		409				{object}	error	"Product already in the collection"
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist/collections/{collectionID}/products/{productID} [put]
+func (app *application) addToWishlistCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getWishlistCollectionFromContext(r)
+	product := getProductFromContext(r)
+
+	if err := app.store.Wishlist.AddToCollection(r.Context(), collection, product.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveFromWishlistCollection godoc
+//
+//	@Summary		Remove a product from a wishlist collection
+//	@Description	Takes a product out of one of the current user's collections. It stays in the wishlist
+//	@Tags			wishlist
+//	@Produce		json
+//	@Param			collectionID	path		int	true	"Collection ID"
+//	@Param			productID		path		int	true	"Product ID"
+//	@Success		204				{object}	nil
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error	"Collection or product not found, or product not in the collection"
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist/collections/{collectionID}/products/{productID} [delete]
+func (app *application) removeFromWishlistCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getWishlistCollectionFromContext(r)
+	product := getProductFromContext(r)
+
+	if err := app.store.Wishlist.RemoveFromCollection(r.Context(), collection.ID, product.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ShareWishlistCollection godoc
+//
+//	@Summary		Share a wishlist collection
+//	@Description	Gives one of the current user's collections a public, read-only link. Sharing it again keeps the same link
+//	@Tags			wishlist
+//	@Produce		json
+//	@Param			collectionID	path		int	true	"Collection ID"
+//	@Success		200				{object}	store.WishlistCollection
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist/collections/{collectionID}/share [put]
+func (app *application) shareWishlistCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getWishlistCollectionFromContext(r)
+
+	if collection.ShareSlug == nil {
+		slug := strings.ReplaceAll(uuid.New().String(), "-", "")
+		collection.ShareSlug = &slug
+	}
+
+	app.saveWishlistCollection(w, r, collection)
+}
+
+// UnshareWishlistCollection godoc
+//
+//	@Summary		Stop sharing a wishlist collection
+//	@Description	Disables the public link of one of the current user's collections
+//	@Tags			wishlist
+//	@Produce		json
+//	@Param			collectionID	path		int	true	"Collection ID"
+//	@Success		200				{object}	store.WishlistCollection
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/wishlist/collections/{collectionID}/share [delete]
+func (app *application) unshareWishlistCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getWishlistCollectionFromContext(r)
+	collection.ShareSlug = nil
+
+	app.saveWishlistCollection(w, r, collection)
+}
+
+// GetSharedWishlist godoc
+//
+//	@Summary		Get a shared wishlist collection
+//	@Description	Retrieves a shared collection and a page of its products. No account needed
+//	@Tags			wishlist
+//	@Produce		json
+//	@Param			slug	path		string	true	"Share slug"
+//	@Param			limit	query		int		false	"Number of items per page"								default(20)
+//	@Param			offset	query		int		false	"Offset for pagination, ignored when a cursor is given"	default(0)
+//	@Param			cursor	query		string	false	"Cursor of the page to get"
+//	@Success		200		{object}	SharedWishlist
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/wishlist/shared/{slug} [get]
+func (app *application) getSharedWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	collection, err := app.store.Wishlist.GetCollectionBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeWishlistCollection(w, r, collection)
+}
+
+func (app *application) writeWishlistCollection(w http.ResponseWriter, r *http.Request, collection *store.WishlistCollection) {
+	fq, ok := app.readListingPage(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := app.store.Wishlist.GetCollectionItems(r.Context(), collection.ID, fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	products := newCursorPage(app.cursors, items)
+	if err := app.jsonResponse(w, http.StatusOK, SharedWishlist{Collection: *collection, Products: products}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) saveWishlistCollection(w http.ResponseWriter, r *http.Request, collection *store.WishlistCollection) {
+	if err := app.store.Wishlist.UpdateCollection(r.Context(), collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collection); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// wishlistCollectionContextMiddleware loads a collection of the current user.
+// Other users' collections are reported as not found.
+func (app *application) wishlistCollectionContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "collectionID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		collection, err := app.store.Wishlist.GetCollectionByID(ctx, id)
+		if err == nil && collection.UserID != getUserFromContext(r).ID {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, wishlistCollectionCtx, collection)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getWishlistCollectionFromContext(r *http.Request) *store.WishlistCollection {
+	return r.Context().Value(wishlistCollectionCtx).(*store.WishlistCollection)
+}
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS entitlements (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    product_id BIGINT NOT NULL,
+    release VARCHAR(100),
+    source VARCHAR(20) NOT NULL CHECK (source IN ('purchase', 'gift', 'free', 'admin')),
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    CONSTRAINT entitlements_user_product_release_key UNIQUE NULLS NOT DISTINCT (user_id, product_id, release)
+);
+
+CREATE INDEX idx_entitlements_user_id ON entitlements (user_id);
+CREATE INDEX idx_entitlements_product_id ON entitlements (product_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS entitlements;
+-- +goose StatementEnd
@@ -0,0 +1,65 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS subscription_plans (
+    id BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    price NUMERIC(10,2) NOT NULL CHECK (price > 0),
+    billing_interval VARCHAR(10) NOT NULL CHECK (billing_interval IN ('day', 'week', 'month', 'year')),
+    interval_count INT NOT NULL DEFAULT 1 CHECK (interval_count > 0),
+    trial_days INT NOT NULL DEFAULT 0 CHECK (trial_days >= 0),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    plan_id BIGINT NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('trialing', 'active', 'past_due', 'canceled', 'expired')),
+    current_period_start TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    current_period_end TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    trial_ends_at TIMESTAMP(0) WITH TIME ZONE,
+    grace_until TIMESTAMP(0) WITH TIME ZONE,
+    canceled_at TIMESTAMP(0) WITH TIME ZONE,
+    next_attempt_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    failed_attempts INT NOT NULL DEFAULT 0,
+    payment_reference VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (plan_id) REFERENCES subscription_plans(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_subscription_plans_product_id ON subscription_plans (product_id);
+CREATE INDEX idx_subscriptions_user_id ON subscriptions (user_id);
+CREATE INDEX idx_subscriptions_next_attempt_at ON subscriptions (next_attempt_at)
+    WHERE status <> 'expired';
+
+ALTER TABLE entitlements
+    ADD COLUMN subscription_id BIGINT REFERENCES subscriptions(id) ON DELETE CASCADE,
+    ADD COLUMN expires_at TIMESTAMP(0) WITH TIME ZONE;
+
+ALTER TABLE entitlements DROP CONSTRAINT IF EXISTS entitlements_source_check;
+ALTER TABLE entitlements
+    ADD CONSTRAINT entitlements_source_check CHECK (source IN ('purchase', 'gift', 'free', 'admin', 'subscription'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM entitlements WHERE source = 'subscription';
+
+ALTER TABLE entitlements DROP CONSTRAINT IF EXISTS entitlements_source_check;
+ALTER TABLE entitlements
+    ADD CONSTRAINT entitlements_source_check CHECK (source IN ('purchase', 'gift', 'free', 'admin'));
+
+ALTER TABLE entitlements
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS subscription_id;
+
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS subscription_plans;
+-- +goose StatementEnd
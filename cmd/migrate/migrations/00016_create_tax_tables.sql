@@ -0,0 +1,99 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE products
+    ADD COLUMN type VARCHAR(20) NOT NULL DEFAULT 'file' CHECK (type IN ('file', 'service', 'item'));
+
+CREATE TABLE IF NOT EXISTS tax_rules (
+    id BIGSERIAL PRIMARY KEY,
+    country CHAR(2) NOT NULL,
+    -- NULL applies the rule to every product type without a more specific rule
+    product_type VARCHAR(20),
+    name VARCHAR(50) NOT NULL DEFAULT 'VAT',
+    rate NUMERIC(6,4) NOT NULL CHECK (rate >= 0 AND rate < 1),
+    valid_from DATE NOT NULL DEFAULT CURRENT_DATE,
+    valid_until DATE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT tax_rules_country_type_valid_from_key UNIQUE NULLS NOT DISTINCT (country, product_type, valid_from)
+);
+
+CREATE TABLE IF NOT EXISTS billing_addresses (
+    user_id BIGINT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(100) NOT NULL,
+    postal_code VARCHAR(20) NOT NULL DEFAULT '',
+    country CHAR(2) NOT NULL,
+    vat_id VARCHAR(20) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE orders
+    ADD COLUMN billing_country CHAR(2),
+    ADD COLUMN buyer_vat_id VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN reverse_charge BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS order_tax_lines (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    country CHAR(2) NOT NULL,
+    rate NUMERIC(6,4) NOT NULL,
+    taxable_amount NUMERIC(10,2) NOT NULL,
+    amount NUMERIC(10,2) NOT NULL,
+    FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_tax_rules_country ON tax_rules (country);
+CREATE INDEX idx_order_tax_lines_order_id ON order_tax_lines (order_id);
+
+-- standard VAT rates for digital goods sold to EU and UK consumers
+INSERT INTO
+    tax_rules (country, rate)
+VALUES
+    ('AT', 0.20),
+    ('BE', 0.21),
+    ('BG', 0.20),
+    ('CY', 0.19),
+    ('CZ', 0.21),
+    ('DE', 0.19),
+    ('DK', 0.25),
+    ('EE', 0.24),
+    ('ES', 0.21),
+    ('FI', 0.255),
+    ('FR', 0.20),
+    ('GR', 0.24),
+    ('HR', 0.25),
+    ('HU', 0.27),
+    ('IE', 0.23),
+    ('IT', 0.22),
+    ('LT', 0.21),
+    ('LU', 0.17),
+    ('LV', 0.21),
+    ('MT', 0.18),
+    ('NL', 0.21),
+    ('PL', 0.23),
+    ('PT', 0.23),
+    ('RO', 0.21),
+    ('SE', 0.25),
+    ('SI', 0.22),
+    ('SK', 0.23),
+    ('GB', 0.20);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS order_tax_lines;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS reverse_charge,
+    DROP COLUMN IF EXISTS buyer_vat_id,
+    DROP COLUMN IF EXISTS billing_country;
+
+DROP TABLE IF EXISTS billing_addresses;
+DROP TABLE IF EXISTS tax_rules;
+
+ALTER TABLE products DROP COLUMN IF EXISTS type;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS gifts (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL UNIQUE,
+    purchaser_id BIGINT NOT NULL,
+    product_id BIGINT NOT NULL,
+    recipient_email citext NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    -- sha256 of the redeem token, the plain token is only ever emailed
+    token bytea NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'redeemed')),
+    recipient_id BIGINT,
+    redeemed_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    FOREIGN KEY (purchaser_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_gifts_purchaser_id ON gifts (purchaser_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS gifts;
+-- +goose StatementEnd
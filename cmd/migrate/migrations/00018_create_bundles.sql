@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE products
+    ADD COLUMN is_bundle BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- members cannot be deleted while a bundle still sells them
+CREATE TABLE IF NOT EXISTS bundle_items (
+    bundle_id BIGINT NOT NULL,
+    product_id BIGINT NOT NULL,
+    PRIMARY KEY (bundle_id, product_id),
+    FOREIGN KEY (bundle_id) REFERENCES products(id) ON DELETE CASCADE,
+    CONSTRAINT bundle_items_product_id_fkey FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX idx_bundle_items_product_id ON bundle_items (product_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS bundle_items;
+
+ALTER TABLE products DROP COLUMN IF EXISTS is_bundle;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- for pay what you want products price holds the minimum the buyer must pay
+ALTER TABLE products
+    ADD COLUMN pricing_mode VARCHAR(10) NOT NULL DEFAULT 'fixed' CHECK (pricing_mode IN ('fixed', 'pwyw', 'free')),
+    ADD COLUMN suggested_price NUMERIC(10,2) CHECK (suggested_price >= price),
+    ADD CONSTRAINT products_price_mode_check CHECK (
+        (pricing_mode = 'fixed' AND price > 0)
+        OR (pricing_mode = 'pwyw' AND price >= 0)
+        OR (pricing_mode = 'free' AND price = 0)
+    );
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE products
+    DROP CONSTRAINT IF EXISTS products_price_mode_check,
+    DROP COLUMN IF EXISTS suggested_price,
+    DROP COLUMN IF EXISTS pricing_mode;
+-- +goose StatementEnd
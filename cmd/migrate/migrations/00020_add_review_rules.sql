@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- keep only the latest review of each user on a product
+DELETE FROM reviews r
+USING reviews newer
+WHERE r.user_id = newer.user_id AND r.product_id = newer.product_id AND r.id < newer.id;
+
+ALTER TABLE reviews
+    ADD CONSTRAINT reviews_user_product_key UNIQUE (user_id, product_id),
+    ADD COLUMN verified_purchase BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE reviews r
+SET verified_purchase = TRUE
+WHERE EXISTS (
+    SELECT 1
+    FROM orders o
+    JOIN order_items oi ON oi.order_id = o.id
+    LEFT JOIN bundle_items bi ON bi.bundle_id = oi.product_id
+    WHERE o.user_id = r.user_id
+        AND o.status = 'paid'
+        AND (oi.product_id = r.product_id OR bi.product_id = r.product_id)
+        AND NOT EXISTS (SELECT 1 FROM gifts g WHERE g.order_id = o.id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE reviews
+    DROP COLUMN IF EXISTS verified_purchase,
+    DROP CONSTRAINT IF EXISTS reviews_user_product_key;
+-- +goose StatementEnd
@@ -0,0 +1,76 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE products
+    ADD COLUMN rating_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN rating_average NUMERIC(3,2) NOT NULL DEFAULT 0,
+    ADD COLUMN rating_1_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN rating_2_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN rating_3_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN rating_4_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN rating_5_count INT NOT NULL DEFAULT 0;
+
+-- recounts the ratings of a product from its reviews
+CREATE OR REPLACE FUNCTION refresh_product_rating(target_product_id BIGINT) RETURNS VOID AS $$
+BEGIN
+    UPDATE products p
+    SET rating_count = agg.total,
+        rating_average = COALESCE(agg.average, 0),
+        rating_1_count = agg.ones,
+        rating_2_count = agg.twos,
+        rating_3_count = agg.threes,
+        rating_4_count = agg.fours,
+        rating_5_count = agg.fives
+    FROM (
+        SELECT
+            COUNT(*) AS total,
+            ROUND(AVG(rating), 2) AS average,
+            COUNT(*) FILTER (WHERE rating = 1) AS ones,
+            COUNT(*) FILTER (WHERE rating = 2) AS twos,
+            COUNT(*) FILTER (WHERE rating = 3) AS threes,
+            COUNT(*) FILTER (WHERE rating = 4) AS fours,
+            COUNT(*) FILTER (WHERE rating = 5) AS fives
+        FROM reviews
+        WHERE product_id = target_product_id
+    ) agg
+    WHERE p.id = target_product_id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION reviews_refresh_product_rating() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM refresh_product_rating(OLD.product_id);
+    END IF;
+
+    IF TG_OP = 'INSERT' OR (TG_OP = 'UPDATE' AND NEW.product_id <> OLD.product_id) THEN
+        PERFORM refresh_product_rating(NEW.product_id);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER reviews_product_rating
+AFTER INSERT OR UPDATE OF rating, product_id OR DELETE ON reviews
+FOR EACH ROW EXECUTE FUNCTION reviews_refresh_product_rating();
+
+SELECT refresh_product_rating(id) FROM products WHERE EXISTS (SELECT 1 FROM reviews WHERE product_id = products.id);
+
+CREATE INDEX idx_products_rating_average ON products (rating_average DESC, rating_count DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS reviews_product_rating ON reviews;
+DROP FUNCTION IF EXISTS reviews_refresh_product_rating();
+DROP FUNCTION IF EXISTS refresh_product_rating(BIGINT);
+
+ALTER TABLE products
+    DROP COLUMN IF EXISTS rating_5_count,
+    DROP COLUMN IF EXISTS rating_4_count,
+    DROP COLUMN IF EXISTS rating_3_count,
+    DROP COLUMN IF EXISTS rating_2_count,
+    DROP COLUMN IF EXISTS rating_1_count,
+    DROP COLUMN IF EXISTS rating_average,
+    DROP COLUMN IF EXISTS rating_count;
+-- +goose StatementEnd
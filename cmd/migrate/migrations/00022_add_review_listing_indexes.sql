@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reviews
+    ADD COLUMN helpful_count INT NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS idx_reviews_product_id;
+
+CREATE INDEX idx_reviews_product_created_at ON reviews (product_id, created_at DESC, id DESC);
+CREATE INDEX idx_reviews_product_rating ON reviews (product_id, rating, created_at DESC, id DESC);
+CREATE INDEX idx_reviews_product_helpful ON reviews (product_id, helpful_count DESC, created_at DESC, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_reviews_product_helpful;
+DROP INDEX IF EXISTS idx_reviews_product_rating;
+DROP INDEX IF EXISTS idx_reviews_product_created_at;
+
+CREATE INDEX IF NOT EXISTS idx_reviews_product_id ON reviews (product_id);
+
+ALTER TABLE reviews
+    DROP COLUMN IF EXISTS helpful_count;
+-- +goose StatementEnd
@@ -0,0 +1,135 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE roles SET level = 4 WHERE name = 'admin';
+
+INSERT INTO
+    roles (name, description, level)
+VALUES
+    (
+        'moderator',
+        'A moderator can review reports and moderate reviews',
+        3
+    );
+
+ALTER TABLE reviews
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'approved' CHECK (status IN ('pending', 'approved', 'rejected', 'hidden'));
+
+CREATE INDEX idx_reviews_pending ON reviews (created_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS reports (
+    id BIGSERIAL PRIMARY KEY,
+    reporter_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    review_id BIGINT REFERENCES reviews(id) ON DELETE CASCADE,
+    product_id BIGINT REFERENCES products(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('spam', 'offensive', 'fake', 'off_topic', 'other')),
+    details TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT reports_target_check CHECK ((review_id IS NULL) <> (product_id IS NULL))
+);
+
+-- a user can only have one open report on the same review or product
+CREATE UNIQUE INDEX reports_open_review_key ON reports (reporter_id, review_id) WHERE status = 'open' AND review_id IS NOT NULL;
+CREATE UNIQUE INDEX reports_open_product_key ON reports (reporter_id, product_id) WHERE status = 'open' AND product_id IS NOT NULL;
+CREATE INDEX idx_reports_status ON reports (status, created_at);
+
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id BIGSERIAL PRIMARY KEY,
+    moderator_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    review_id BIGINT REFERENCES reviews(id) ON DELETE SET NULL,
+    report_id BIGINT REFERENCES reports(id) ON DELETE SET NULL,
+    action VARCHAR(20) NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_moderation_actions_created_at ON moderation_actions (created_at DESC);
+
+-- only approved reviews count towards the ratings
+CREATE OR REPLACE FUNCTION refresh_product_rating(target_product_id BIGINT) RETURNS VOID AS $$
+BEGIN
+    UPDATE products p
+    SET rating_count = agg.total,
+        rating_average = COALESCE(agg.average, 0),
+        rating_1_count = agg.ones,
+        rating_2_count = agg.twos,
+        rating_3_count = agg.threes,
+        rating_4_count = agg.fours,
+        rating_5_count = agg.fives
+    FROM (
+        SELECT
+            COUNT(*) AS total,
+            ROUND(AVG(rating), 2) AS average,
+            COUNT(*) FILTER (WHERE rating = 1) AS ones,
+            COUNT(*) FILTER (WHERE rating = 2) AS twos,
+            COUNT(*) FILTER (WHERE rating = 3) AS threes,
+            COUNT(*) FILTER (WHERE rating = 4) AS fours,
+            COUNT(*) FILTER (WHERE rating = 5) AS fives
+        FROM reviews
+        WHERE product_id = target_product_id AND status = 'approved'
+    ) agg
+    WHERE p.id = target_product_id;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS reviews_product_rating ON reviews;
+
+CREATE TRIGGER reviews_product_rating
+AFTER INSERT OR UPDATE OF rating, product_id, status OR DELETE ON reviews
+FOR EACH ROW EXECUTE FUNCTION reviews_refresh_product_rating();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS reviews_product_rating ON reviews;
+
+CREATE TRIGGER reviews_product_rating
+AFTER INSERT OR UPDATE OF rating, product_id OR DELETE ON reviews
+FOR EACH ROW EXECUTE FUNCTION reviews_refresh_product_rating();
+
+CREATE OR REPLACE FUNCTION refresh_product_rating(target_product_id BIGINT) RETURNS VOID AS $$
+BEGIN
+    UPDATE products p
+    SET rating_count = agg.total,
+        rating_average = COALESCE(agg.average, 0),
+        rating_1_count = agg.ones,
+        rating_2_count = agg.twos,
+        rating_3_count = agg.threes,
+        rating_4_count = agg.fours,
+        rating_5_count = agg.fives
+    FROM (
+        SELECT
+            COUNT(*) AS total,
+            ROUND(AVG(rating), 2) AS average,
+            COUNT(*) FILTER (WHERE rating = 1) AS ones,
+            COUNT(*) FILTER (WHERE rating = 2) AS twos,
+            COUNT(*) FILTER (WHERE rating = 3) AS threes,
+            COUNT(*) FILTER (WHERE rating = 4) AS fours,
+            COUNT(*) FILTER (WHERE rating = 5) AS fives
+        FROM reviews
+        WHERE product_id = target_product_id
+    ) agg
+    WHERE p.id = target_product_id;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS moderation_actions;
+DROP TABLE IF EXISTS reports;
+
+DROP INDEX IF EXISTS idx_reviews_pending;
+
+ALTER TABLE reviews
+    DROP COLUMN IF EXISTS status;
+
+UPDATE users
+SET role_id = (SELECT id FROM roles WHERE name = 'user')
+WHERE role_id = (SELECT id FROM roles WHERE name = 'moderator');
+
+DELETE FROM roles WHERE name = 'moderator';
+
+UPDATE roles SET level = 3 WHERE name = 'admin';
+
+SELECT refresh_product_rating(id) FROM products WHERE EXISTS (SELECT 1 FROM reviews WHERE product_id = products.id);
+-- +goose StatementEnd
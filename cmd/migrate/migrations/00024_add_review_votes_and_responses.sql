@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS review_votes (
+    review_id BIGINT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (review_id, user_id)
+);
+
+CREATE INDEX idx_review_votes_user_id ON review_votes (user_id);
+
+-- keeps reviews.helpful_count, the score the reviews are sorted by, in sync
+CREATE OR REPLACE FUNCTION review_votes_refresh_helpful_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE reviews SET helpful_count = helpful_count + 1 WHERE id = NEW.review_id;
+    ELSE
+        UPDATE reviews SET helpful_count = helpful_count - 1 WHERE id = OLD.review_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER review_votes_helpful_count
+AFTER INSERT OR DELETE ON review_votes
+FOR EACH ROW EXECUTE FUNCTION review_votes_refresh_helpful_count();
+
+CREATE TABLE IF NOT EXISTS review_responses (
+    id BIGSERIAL PRIMARY KEY,
+    review_id BIGINT NOT NULL UNIQUE REFERENCES reviews(id) ON DELETE CASCADE,
+    seller_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS review_responses;
+
+DROP TRIGGER IF EXISTS review_votes_helpful_count ON review_votes;
+DROP FUNCTION IF EXISTS review_votes_refresh_helpful_count();
+DROP TABLE IF EXISTS review_votes;
+
+UPDATE reviews SET helpful_count = 0;
+-- +goose StatementEnd
@@ -0,0 +1,62 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE products
+    ADD COLUMN wishlist_count INT NOT NULL DEFAULT 0;
+
+UPDATE products p
+SET wishlist_count = w.total
+FROM (SELECT product_id, COUNT(*) AS total FROM user_wishlist GROUP BY product_id) w
+WHERE w.product_id = p.id;
+
+-- keeps products.wishlist_count in sync with the wishlists
+CREATE OR REPLACE FUNCTION user_wishlist_refresh_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE products SET wishlist_count = wishlist_count + 1 WHERE id = NEW.product_id;
+    ELSE
+        UPDATE products SET wishlist_count = wishlist_count - 1 WHERE id = OLD.product_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_wishlist_count
+AFTER INSERT OR DELETE ON user_wishlist
+FOR EACH ROW EXECUTE FUNCTION user_wishlist_refresh_count();
+
+CREATE TABLE IF NOT EXISTS wishlist_collections (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    share_slug VARCHAR(32) UNIQUE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT wishlist_collections_user_name_key UNIQUE (user_id, name)
+);
+
+-- collections group wishlisted products, so removing a product from the
+-- wishlist removes it from the collections too
+CREATE TABLE IF NOT EXISTS wishlist_collection_items (
+    collection_id BIGINT NOT NULL REFERENCES wishlist_collections(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    product_id BIGINT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (collection_id, product_id),
+    FOREIGN KEY (user_id, product_id) REFERENCES user_wishlist(user_id, product_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_wishlist_collection_items_user_product ON wishlist_collection_items (user_id, product_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wishlist_collection_items;
+DROP TABLE IF EXISTS wishlist_collections;
+
+DROP TRIGGER IF EXISTS user_wishlist_count ON user_wishlist;
+DROP FUNCTION IF EXISTS user_wishlist_refresh_count();
+
+ALTER TABLE products
+    DROP COLUMN IF EXISTS wishlist_count;
+-- +goose StatementEnd
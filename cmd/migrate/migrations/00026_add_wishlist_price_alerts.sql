@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE products
+    ADD COLUMN sale_price NUMERIC(10,2) CHECK (sale_price >= 0),
+    ADD COLUMN sale_starts_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN sale_ends_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD CONSTRAINT products_sale_check CHECK (
+        (sale_price IS NULL AND sale_starts_at IS NULL AND sale_ends_at IS NULL)
+        OR (sale_price IS NOT NULL AND sale_starts_at IS NOT NULL AND sale_ends_at > sale_starts_at)
+    );
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    price_drop_alerts BOOLEAN NOT NULL DEFAULT TRUE,
+    sale_alerts BOOLEAN NOT NULL DEFAULT TRUE,
+    unsubscribe_token UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    last_digest_at TIMESTAMP(0) WITH TIME ZONE,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- alerts wait here until the user's next digest email; available_at delays
+-- the alert of a sale until it starts
+CREATE TABLE IF NOT EXISTS price_alerts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('price_drop', 'sale')),
+    old_price NUMERIC(10,2) NOT NULL,
+    new_price NUMERIC(10,2) NOT NULL,
+    available_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- a later change of the same kind replaces the pending alert
+CREATE UNIQUE INDEX price_alerts_pending_key ON price_alerts (user_id, product_id, kind) WHERE sent_at IS NULL;
+CREATE INDEX idx_price_alerts_pending ON price_alerts (available_at) WHERE sent_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS price_alerts;
+DROP TABLE IF EXISTS notification_preferences;
+
+ALTER TABLE products
+    DROP CONSTRAINT IF EXISTS products_sale_check,
+    DROP COLUMN IF EXISTS sale_ends_at,
+    DROP COLUMN IF EXISTS sale_starts_at,
+    DROP COLUMN IF EXISTS sale_price;
+-- +goose StatementEnd
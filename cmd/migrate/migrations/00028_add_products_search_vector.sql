@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- array_to_string is only stable, which generated columns don't accept
+CREATE OR REPLACE FUNCTION immutable_array_to_string(arr TEXT[], sep TEXT)
+RETURNS TEXT AS $$
+    SELECT array_to_string(arr, sep);
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE products ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE(immutable_array_to_string(categories, ' '), '')), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING gin (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_products_search_vector;
+ALTER TABLE products DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS immutable_array_to_string(TEXT[], TEXT);
+-- +goose StatementEnd
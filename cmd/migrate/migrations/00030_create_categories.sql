@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS categories (
+    id BIGSERIAL PRIMARY KEY,
+    parent_id BIGINT,
+    slug VARCHAR(100) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT categories_slug_key UNIQUE (slug),
+    CONSTRAINT categories_slug_check CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$'),
+    FOREIGN KEY (parent_id) REFERENCES categories(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX idx_categories_parent_id ON categories (parent_id);
+
+-- products keep their categories as slugs: spellings like "Music" and " music"
+-- fold into the same slug, and the duplicates are dropped keeping the order
+UPDATE products p
+SET categories = ARRAY(
+    SELECT n.slug
+    FROM unnest(p.categories) WITH ORDINALITY AS c(category, position),
+        LATERAL (
+            SELECT trim(BOTH '-' FROM left(trim(BOTH '-' FROM regexp_replace(lower(c.category), '[^a-z0-9]+', '-', 'g')), 100)) AS slug
+        ) n
+    WHERE n.slug <> ''
+    GROUP BY n.slug
+    ORDER BY MIN(c.position)
+);
+
+-- every category in use becomes a top-level one, for admins to curate
+INSERT INTO
+    categories (slug, name)
+SELECT DISTINCT c.slug, initcap(replace(c.slug, '-', ' '))
+FROM products p, unnest(p.categories) AS c(slug)
+ON CONFLICT (slug) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS categories;
+-- +goose StatementEnd
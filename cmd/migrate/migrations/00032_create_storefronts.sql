@@ -0,0 +1,81 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS storefronts (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    slug VARCHAR(100) NOT NULL,
+    banner_url TEXT NOT NULL DEFAULT '',
+    about TEXT NOT NULL DEFAULT '',
+    links TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT storefronts_slug_key UNIQUE (slug),
+    CONSTRAINT storefronts_slug_check CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$')
+);
+
+-- the slug a storefront starts with, taken from the username and leaving room
+-- for the id to be appended when it is taken
+CREATE OR REPLACE FUNCTION storefront_slug(username TEXT) RETURNS TEXT AS $$
+    SELECT COALESCE(
+        NULLIF(trim(BOTH '-' FROM left(trim(BOTH '-' FROM regexp_replace(lower(username), '[^a-z0-9]+', '-', 'g')), 80)), ''),
+        'seller'
+    );
+$$ LANGUAGE sql IMMUTABLE;
+
+-- creates the user's storefront with the first free slug: the one taken from
+-- the username, else with the id appended, else with a counter after that.
+-- Sellers can't pick slugs ending in a number, but usernames can, so the
+-- appended ones may still be taken
+CREATE OR REPLACE FUNCTION create_storefront(target_user_id BIGINT, target_username TEXT) RETURNS VOID AS $$
+DECLARE
+    base TEXT := storefront_slug(target_username);
+    candidate TEXT := base;
+    attempt INT := 0;
+BEGIN
+    LOOP
+        INSERT INTO storefronts (user_id, slug)
+        VALUES (target_user_id, candidate)
+        ON CONFLICT (slug) DO NOTHING;
+
+        EXIT WHEN FOUND;
+
+        attempt := attempt + 1;
+        candidate := base || '-' || target_user_id;
+        IF attempt > 1 THEN
+            candidate := candidate || '-' || attempt;
+        END IF;
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+DECLARE
+    u RECORD;
+BEGIN
+    FOR u IN SELECT id, username FROM users ORDER BY id LOOP
+        PERFORM create_storefront(u.id, u.username);
+    END LOOP;
+END;
+$$;
+
+-- every new user gets a storefront
+CREATE OR REPLACE FUNCTION users_create_storefront() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM create_storefront(NEW.id, NEW.username);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_storefront
+AFTER INSERT ON users
+FOR EACH ROW EXECUTE FUNCTION users_create_storefront();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS users_storefront ON users;
+DROP FUNCTION IF EXISTS users_create_storefront();
+DROP FUNCTION IF EXISTS create_storefront(BIGINT, TEXT);
+DROP FUNCTION IF EXISTS storefront_slug(TEXT);
+DROP TABLE IF EXISTS storefronts;
+-- +goose StatementEnd
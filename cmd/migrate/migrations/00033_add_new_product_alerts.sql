@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE notification_preferences
+    ADD COLUMN new_product_alerts BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- the new products of followed sellers wait here until the follower's next
+-- digest email
+CREATE TABLE IF NOT EXISTS new_product_alerts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sent_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT new_product_alerts_user_product_key UNIQUE (user_id, product_id)
+);
+
+CREATE INDEX idx_new_product_alerts_pending ON new_product_alerts (user_id) WHERE sent_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS new_product_alerts;
+
+ALTER TABLE notification_preferences
+    DROP COLUMN IF EXISTS new_product_alerts;
+-- +goose StatementEnd
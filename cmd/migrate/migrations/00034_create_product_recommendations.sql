@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- both tables are recomputed from scratch by the recommendations job
+CREATE TABLE IF NOT EXISTS product_trending (
+    product_id BIGINT PRIMARY KEY REFERENCES products(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_product_trending_score ON product_trending (score DESC);
+
+-- related_id was bought or wishlisted by score of the users who did the same
+-- with product_id
+CREATE TABLE IF NOT EXISTS product_related (
+    product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    related_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('bought', 'wishlisted')),
+    score INT NOT NULL,
+    PRIMARY KEY (product_id, kind, related_id)
+);
+
+CREATE INDEX idx_product_related_score ON product_related (product_id, kind, score DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS product_related;
+DROP TABLE IF EXISTS product_trending;
+-- +goose StatementEnd
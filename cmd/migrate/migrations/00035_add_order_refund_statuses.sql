@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders
+    ADD CONSTRAINT orders_status_check CHECK (status IN ('pending', 'paid', 'failed', 'refunded', 'unfulfilled'));
+
+CREATE INDEX idx_orders_unfulfilled ON orders (created_at) WHERE status = 'unfulfilled';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_orders_unfulfilled;
+
+UPDATE orders SET status = 'failed' WHERE status IN ('refunded', 'unfulfilled');
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders
+    ADD CONSTRAINT orders_status_check CHECK (status IN ('pending', 'paid', 'failed'));
+-- +goose StatementEnd
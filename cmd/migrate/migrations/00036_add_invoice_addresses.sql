@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the billing address the order was taxed on, copied when the order is placed
+ALTER TABLE orders
+    ADD COLUMN billing_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN billing_line1 VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN billing_line2 VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN billing_city VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN billing_postal_code VARCHAR(20) NOT NULL DEFAULT '';
+
+-- the seller's legal name, address and VAT ID, copied from their billing
+-- address when the invoice is issued
+ALTER TABLE invoices
+    ADD COLUMN seller_legal_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN seller_line1 VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN seller_line2 VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN seller_city VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN seller_postal_code VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN seller_country CHAR(2),
+    ADD COLUMN seller_vat_id VARCHAR(20) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS seller_vat_id,
+    DROP COLUMN IF EXISTS seller_country,
+    DROP COLUMN IF EXISTS seller_postal_code,
+    DROP COLUMN IF EXISTS seller_city,
+    DROP COLUMN IF EXISTS seller_line2,
+    DROP COLUMN IF EXISTS seller_line1,
+    DROP COLUMN IF EXISTS seller_legal_name;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS billing_postal_code,
+    DROP COLUMN IF EXISTS billing_city,
+    DROP COLUMN IF EXISTS billing_line2,
+    DROP COLUMN IF EXISTS billing_line1,
+    DROP COLUMN IF EXISTS billing_name;
+-- +goose StatementEnd
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 
 	"math/rand"
 
@@ -65,11 +66,18 @@ var productDescriptions = []string{
 	"Analyze your business data with our business analytics software. Perfect for business owners, marketers, and data analysts looking to grow their business and increase sales.",
 }
 
-var categories = []string{
-	"electronics", "clothing", "home", "garden", "sports", "books", "music",
-	"art", "toys", "food", "health", "beauty", "automotive", "travel", "pets",
-	"finance", "education", "technology", "gaming", "movies", "music", "sports",
-	"art", "toys", "food", "health", "beauty", "automotive", "travel", "pets",
+// categories are seeded as a taxonomy, each after its parent.
+var categories = []struct {
+	slug   string
+	parent string
+}{
+	{"technology", ""}, {"electronics", "technology"},
+	{"entertainment", ""}, {"music", "entertainment"}, {"movies", "entertainment"},
+	{"books", "entertainment"}, {"gaming", "entertainment"}, {"toys", "entertainment"},
+	{"lifestyle", ""}, {"clothing", "lifestyle"}, {"beauty", "lifestyle"}, {"food", "lifestyle"},
+	{"travel", "lifestyle"}, {"pets", "lifestyle"}, {"home", "lifestyle"}, {"garden", "home"},
+	{"health", ""}, {"sports", "health"},
+	{"art", ""}, {"education", ""}, {"finance", ""}, {"automotive", ""},
 }
 var productReviews = []string{
 	"This software is amazing! I've been using it for my video editing projects and it's really helped me create professional-quality videos.",
@@ -114,6 +122,11 @@ func Seed(store *store.Storage, db *sql.DB) error {
 
 	tx.Commit()
 
+	if err := seedCategories(ctx, store); err != nil {
+		log.Printf("error creating category: %v", err)
+		return err
+	}
+
 	products := generateProducts(200, users)
 	for _, product := range products {
 		if err := store.Products.Create(ctx, product); err != nil {
@@ -160,29 +173,67 @@ func generateProducts(n int, users []*store.User) []*store.Product {
 			Name:        productNames[rand.Intn(len(productNames))],
 			Price:       rand.Float64() * 100,
 			Description: productDescriptions[rand.Intn(len(productDescriptions))],
-			Categories: []string{
-				categories[rand.Intn(len(categories))],
-				categories[rand.Intn(len(categories))],
-			},
+			Categories:  pickCategories(2),
 		}
 	}
 
 	return products
 }
 
+func seedCategories(ctx context.Context, s *store.Storage) error {
+	ids := make(map[string]int64, len(categories))
+
+	for _, c := range categories {
+		category := &store.Category{
+			Slug: c.slug,
+			Name: strings.ToUpper(c.slug[:1]) + c.slug[1:],
+		}
+		if c.parent != "" {
+			parentID := ids[c.parent]
+			category.ParentID = &parentID
+		}
+
+		if err := s.Categories.Create(ctx, category); err != nil {
+			return err
+		}
+		ids[c.slug] = category.ID
+	}
+
+	return nil
+}
+
+// pickCategories returns n distinct category slugs at random.
+func pickCategories(n int) []string {
+	slugs := make([]string, 0, n)
+	for _, i := range rand.Perm(len(categories))[:n] {
+		slugs = append(slugs, categories[i].slug)
+	}
+
+	return slugs
+}
+
 func generateReviews(n int, users []*store.User, products []*store.Product) []*store.Review {
-	reviews := make([]*store.Review, n)
+	reviews := make([]*store.Review, 0, n)
 
-	for i := 0; i < n; i++ {
+	// one review per user and product, and never on the user's own product
+	reviewed := make(map[[2]int64]bool)
+
+	for len(reviews) < n {
 		user := users[rand.Intn(len(users))]
 		product := products[rand.Intn(len(products))]
 
-		reviews[i] = &store.Review{
+		key := [2]int64{user.ID, product.ID}
+		if product.UserID == user.ID || reviewed[key] {
+			continue
+		}
+		reviewed[key] = true
+
+		reviews = append(reviews, &store.Review{
 			UserID:    user.ID,
 			ProductID: product.ID,
 			Rating:    rand.Intn(5) + 1,
 			Comment:   productReviews[rand.Intn(len(productReviews))],
-		}
+		})
 	}
 
 	log.Println("seeding complete")
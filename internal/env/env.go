@@ -38,3 +38,16 @@ func GetBool(key string, fallback bool) bool {
 	}
 	return b
 }
+
+func GetFloat(key string, fallback float64) float64 {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fallback
+	}
+	return f
+}
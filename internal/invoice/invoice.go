@@ -0,0 +1,166 @@
+package invoice
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+type Party struct {
+	Name string
+	// Address lines, printed under the name.
+	Address []string
+	Email   string
+	VATID   string
+}
+
+type Line struct {
+	Description string
+	Quantity    int
+	UnitPrice   float64
+}
+
+type TaxLine struct {
+	Label  string
+	Amount float64
+}
+
+// Document holds everything printed on an invoice. Amounts are passed in
+// already computed so the rendered totals always match the stored order.
+type Document struct {
+	Number   string
+	IssuedAt time.Time
+	OrderID  int64
+	Seller   Party
+	Buyer    Party
+	Lines    []Line
+	TaxLines []TaxLine
+	Subtotal float64
+	TaxTotal float64
+	Total    float64
+	// ReverseCharge prints the notice that the buyer accounts for the VAT.
+	ReverseCharge bool
+}
+
+const (
+	pageMargin = 20.0
+	lineHeight = 7.0
+)
+
+// Render writes the invoice as a PDF document to w. It only uses the core PDF
+// fonts, so no font files or external binaries are needed.
+func Render(w io.Writer, doc Document) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pageMargin, pageMargin, pageMargin)
+	pdf.SetAutoPageBreak(true, pageMargin)
+	pdf.SetTitle(fmt.Sprintf("Invoice %s", doc.Number), true)
+	pdf.SetCreationDate(doc.IssuedAt)
+	pdf.AddPage()
+
+	// core fonts are cp1252 encoded, translate user supplied text into it
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pageWidth, _ := pdf.GetPageSize()
+	contentWidth := pageWidth - 2*pageMargin
+
+	// Header
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(contentWidth/2, 10, "INVOICE", "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(contentWidth/2, 5, tr("Invoice no. "+doc.Number), "", 2, "R", false, 0, "")
+	pdf.CellFormat(contentWidth/2, 5, "Issued "+doc.IssuedAt.Format("January 2, 2006"), "", 2, "R", false, 0, "")
+	pdf.CellFormat(contentWidth/2, 5, fmt.Sprintf("Order #%d", doc.OrderID), "", 1, "R", false, 0, "")
+	pdf.Ln(8)
+
+	// Parties
+	partyWidth := contentWidth / 2
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(partyWidth, 6, "Seller", "", 0, "L", false, 0, "")
+	pdf.CellFormat(partyWidth, 6, "Billed to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(partyWidth, 5, tr(doc.Seller.Name), "", 0, "L", false, 0, "")
+	pdf.CellFormat(partyWidth, 5, tr(doc.Buyer.Name), "", 1, "L", false, 0, "")
+	for i := 0; i < max(len(doc.Seller.Address), len(doc.Buyer.Address)); i++ {
+		pdf.CellFormat(partyWidth, 5, tr(addressLine(doc.Seller.Address, i)), "", 0, "L", false, 0, "")
+		pdf.CellFormat(partyWidth, 5, tr(addressLine(doc.Buyer.Address, i)), "", 1, "L", false, 0, "")
+	}
+	pdf.CellFormat(partyWidth, 5, tr(doc.Seller.Email), "", 0, "L", false, 0, "")
+	pdf.CellFormat(partyWidth, 5, tr(doc.Buyer.Email), "", 1, "L", false, 0, "")
+	if doc.Seller.VATID != "" || doc.Buyer.VATID != "" {
+		pdf.CellFormat(partyWidth, 5, vatLabel(tr(doc.Seller.VATID)), "", 0, "L", false, 0, "")
+		pdf.CellFormat(partyWidth, 5, vatLabel(tr(doc.Buyer.VATID)), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(10)
+
+	// Lines
+	descWidth := contentWidth * 0.55
+	qtyWidth := contentWidth * 0.1
+	priceWidth := contentWidth * 0.175
+	amountWidth := contentWidth - descWidth - qtyWidth - priceWidth
+
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(235, 235, 235)
+	pdf.CellFormat(descWidth, lineHeight, "Description", "B", 0, "L", true, 0, "")
+	pdf.CellFormat(qtyWidth, lineHeight, "Qty", "B", 0, "R", true, 0, "")
+	pdf.CellFormat(priceWidth, lineHeight, "Unit price", "B", 0, "R", true, 0, "")
+	pdf.CellFormat(amountWidth, lineHeight, "Amount", "B", 1, "R", true, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range doc.Lines {
+		pdf.CellFormat(descWidth, lineHeight, tr(line.Description), "", 0, "L", false, 0, "")
+		pdf.CellFormat(qtyWidth, lineHeight, fmt.Sprintf("%d", line.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(priceWidth, lineHeight, formatAmount(line.UnitPrice), "", 0, "R", false, 0, "")
+		pdf.CellFormat(amountWidth, lineHeight, formatAmount(line.UnitPrice*float64(line.Quantity)), "", 1, "R", false, 0, "")
+	}
+
+	// Totals
+	labelWidth := contentWidth - amountWidth
+	pdf.Ln(2)
+	pdf.Line(pageMargin+labelWidth/2, pdf.GetY(), pageMargin+contentWidth, pdf.GetY())
+	pdf.CellFormat(labelWidth, lineHeight, "Subtotal", "", 0, "R", false, 0, "")
+	pdf.CellFormat(amountWidth, lineHeight, formatAmount(doc.Subtotal), "", 1, "R", false, 0, "")
+
+	for _, tax := range doc.TaxLines {
+		pdf.CellFormat(labelWidth, lineHeight, tr(tax.Label), "", 0, "R", false, 0, "")
+		pdf.CellFormat(amountWidth, lineHeight, formatAmount(tax.Amount), "", 1, "R", false, 0, "")
+	}
+
+	if len(doc.TaxLines) == 0 {
+		pdf.CellFormat(labelWidth, lineHeight, "Tax", "", 0, "R", false, 0, "")
+		pdf.CellFormat(amountWidth, lineHeight, formatAmount(doc.TaxTotal), "", 1, "R", false, 0, "")
+	}
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(labelWidth, lineHeight, "Total", "T", 0, "R", false, 0, "")
+	pdf.CellFormat(amountWidth, lineHeight, formatAmount(doc.Total), "T", 1, "R", false, 0, "")
+
+	pdf.Ln(12)
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.SetTextColor(110, 110, 110)
+	if doc.ReverseCharge {
+		pdf.MultiCell(contentWidth, 4, "Reverse charge: VAT to be accounted for by the recipient.", "", "L", false)
+	}
+	pdf.MultiCell(contentWidth, 4, "Digital goods sold through Digitally. Thank you for your purchase.", "", "L", false)
+
+	return pdf.Output(w)
+}
+
+func addressLine(address []string, i int) string {
+	if i >= len(address) {
+		return ""
+	}
+	return address[i]
+}
+
+func vatLabel(vatID string) string {
+	if vatID == "" {
+		return ""
+	}
+	return "VAT ID " + vatID
+}
+
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
@@ -6,11 +6,23 @@ const (
 	FromName              = "Digitally"
 	maxRetries            = 3
 	ActivationURLTemplate = "user_invitation.tmpl"
+
+	SubscriptionPaymentFailedTemplate = "subscription_payment_failed.tmpl"
+	PurchaseConfirmationTemplate      = "purchase_confirmation.tmpl"
+	GiftReceivedTemplate              = "gift_received.tmpl"
+	ReviewResponseTemplate            = "review_response.tmpl"
+	WishlistDigestTemplate            = "wishlist_digest.tmpl"
 )
 
 //go:embed templates
 var FS embed.FS
 
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
 type Client interface {
-	Send(templateFile, username, email string, data any, isSandbox bool) (int, error)
+	Send(templateFile, username, email string, data any, isSandbox bool, attachments ...Attachment) (int, error)
 }
@@ -2,6 +2,7 @@ package mailer
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -17,11 +18,12 @@ type MailtrapMailer struct {
 }
 
 type mailtrapRequest struct {
-	From     mailtrapFrom `json:"from"`
-	To       []mailtrapTo `json:"to"`
-	Subject  string       `json:"subject"`
-	HTML     string       `json:"html"`
-	Category string       `json:"category"`
+	From        mailtrapFrom         `json:"from"`
+	To          []mailtrapTo         `json:"to"`
+	Subject     string               `json:"subject"`
+	HTML        string               `json:"html"`
+	Category    string               `json:"category"`
+	Attachments []mailtrapAttachment `json:"attachments,omitempty"`
 }
 
 type mailtrapFrom struct {
@@ -33,6 +35,13 @@ type mailtrapTo struct {
 	Email string `json:"email"`
 }
 
+type mailtrapAttachment struct {
+	Content     string `json:"content"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type"`
+	Disposition string `json:"disposition"`
+}
+
 func NewMailtrapMailer(apiKey, fromEmail, inboxID string) *MailtrapMailer {
 	return &MailtrapMailer{
 		apiKey:  apiKey,
@@ -41,7 +50,7 @@ func NewMailtrapMailer(apiKey, fromEmail, inboxID string) *MailtrapMailer {
 	}
 }
 
-func (m *MailtrapMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
+func (m *MailtrapMailer) Send(templateFile, username, email string, data any, isSandbox bool, attachments ...Attachment) (int, error) {
 	// Parse template
 	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
 	if err != nil {
@@ -75,6 +84,15 @@ func (m *MailtrapMailer) Send(templateFile, username, email string, data any, is
 		Category: "User Activation",
 	}
 
+	for _, a := range attachments {
+		payload.Attachments = append(payload.Attachments, mailtrapAttachment{
+			Content:     base64.StdEncoding.EncodeToString(a.Content),
+			Filename:    a.Filename,
+			Type:        a.ContentType,
+			Disposition: "attachment",
+		})
+	}
+
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
 		return -1, fmt.Errorf("failed to marshal request: %v", err)
@@ -2,6 +2,7 @@ package mailer
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"html/template"
 	"log"
@@ -27,7 +28,7 @@ func NewSendGridMailer(fromEmail, apiKey string) *SendGridMailer {
 	}
 }
 
-func (m *SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+func (m *SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool, attachments ...Attachment) error {
 	from := mail.NewEmail(FromName, m.fromEmail)
 	to := mail.NewEmail(username, email)
 
@@ -51,6 +52,15 @@ func (m *SendGridMailer) Send(templateFile, username, email string, data any, is
 
 	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
 
+	for _, a := range attachments {
+		attachment := mail.NewAttachment()
+		attachment.SetContent(base64.StdEncoding.EncodeToString(a.Content))
+		attachment.SetType(a.ContentType)
+		attachment.SetFilename(a.Filename)
+		attachment.SetDisposition("attachment")
+		message.AddAttachment(attachment)
+	}
+
 	message.SetMailSettings(&mail.MailSettings{
 		SandboxMode: &mail.Setting{
 			Enable: &isSandbox,
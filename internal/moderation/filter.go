@@ -0,0 +1,115 @@
+package moderation
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+const (
+	// shoutingMinLetters is how many letters a text needs before its case is
+	// looked at, so short texts like "OK" aren't held.
+	shoutingMinLetters = 20
+	shoutingRatio      = 0.7
+	maxRepeatedRunes   = 5
+)
+
+// Filter flags texts that look abusive or spammy so they can be held for a
+// moderator instead of being published right away.
+type Filter struct {
+	words    map[string]struct{}
+	maxLinks int
+}
+
+// NewFilter returns a filter holding texts that contain any of the blocked
+// words, case insensitively, or more than maxLinks links.
+func NewFilter(blockedWords []string, maxLinks int) *Filter {
+	words := make(map[string]struct{}, len(blockedWords))
+	for _, word := range blockedWords {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			words[word] = struct{}{}
+		}
+	}
+
+	return &Filter{
+		words:    words,
+		maxLinks: maxLinks,
+	}
+}
+
+// Check returns why the text looks suspicious, or nothing when it looks fine.
+func (f *Filter) Check(text string) []string {
+	var reasons []string
+
+	if f.hasBlockedWord(text) {
+		reasons = append(reasons, "contains a blocked word")
+	}
+
+	if len(linkPattern.FindAllString(text, -1)) > f.maxLinks {
+		reasons = append(reasons, "contains too many links")
+	}
+
+	if isShouting(text) {
+		reasons = append(reasons, "mostly written in capitals")
+	}
+
+	if hasRepeatedRunes(text) {
+		reasons = append(reasons, "contains repeated characters")
+	}
+
+	return reasons
+}
+
+func (f *Filter) hasBlockedWord(text string) bool {
+	if len(f.words) == 0 {
+		return false
+	}
+
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, field := range fields {
+		if _, ok := f.words[field]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isShouting(text string) bool {
+	var letters, upper int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+
+	return letters >= shoutingMinLetters && float64(upper)/float64(letters) > shoutingRatio
+}
+
+func hasRepeatedRunes(text string) bool {
+	var last rune
+	var run int
+	for _, r := range text {
+		if r == last && !unicode.IsSpace(r) {
+			run++
+			if run > maxRepeatedRunes {
+				return true
+			}
+			continue
+		}
+		last = r
+		run = 1
+	}
+
+	return false
+}
@@ -0,0 +1,23 @@
+package payment
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrDeclined = errors.New("payment declined")
+
+type Charge struct {
+	CustomerID  int64
+	Amount      float64
+	Description string
+	// IdempotencyKey lets the provider recognise a retried charge so the
+	// customer is never billed twice for the same thing.
+	IdempotencyKey string
+}
+
+type Provider interface {
+	Charge(ctx context.Context, charge Charge) (reference string, err error)
+	// Refund gives the customer back the whole charge with the reference.
+	Refund(ctx context.Context, reference string) error
+}
@@ -0,0 +1,28 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// SandboxProvider approves every charge without moving any money. It is meant
+// for development until a real payment provider is configured.
+type SandboxProvider struct{}
+
+func NewSandboxProvider() *SandboxProvider {
+	return &SandboxProvider{}
+}
+
+func (p *SandboxProvider) Charge(ctx context.Context, charge Charge) (string, error) {
+	if charge.Amount < 0 {
+		return "", fmt.Errorf("%w: invalid amount %.2f", ErrDeclined, charge.Amount)
+	}
+
+	return "sandbox_" + uuid.NewString(), nil
+}
+
+func (p *SandboxProvider) Refund(ctx context.Context, reference string) error {
+	return nil
+}
@@ -0,0 +1,210 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// searchFields are the fields searched, weighed like the Postgres search does:
+// the name first, then the categories and the description.
+var searchFields = []struct {
+	name  string
+	boost float64
+}{
+	{"name", 3},
+	{"categories", 2},
+	{"description", 1},
+}
+
+// BleveIndex is an Index kept on disk by Bleve, within the process using it.
+// Only one process can open it at a time.
+type BleveIndex struct {
+	index bleve.Index
+}
+
+// OpenBleveIndex opens the index at path, creating it when there is none.
+func OpenBleveIndex(path string) (*BleveIndex, error) {
+	index, err := bleve.Open(path)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		index, err = bleve.New(path, newIndexMapping())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &BleveIndex{index: index}, nil
+}
+
+func newIndexMapping() mapping.IndexMapping {
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = en.AnalyzerName
+	text.Store = false
+
+	product := bleve.NewDocumentStaticMapping()
+	for _, field := range searchFields {
+		product.AddFieldMappingsAt(field.name, text)
+	}
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = product
+	m.DefaultAnalyzer = en.AnalyzerName
+
+	return m
+}
+
+func (b *BleveIndex) Index(ctx context.Context, docs ...Document) error {
+	batch := b.index.NewBatch()
+	for _, doc := range docs {
+		if err := batch.Index(strconv.FormatInt(doc.ID, 10), doc); err != nil {
+			return err
+		}
+	}
+
+	return b.index.Batch(batch)
+}
+
+func (b *BleveIndex) Delete(ctx context.Context, ids ...int64) error {
+	batch := b.index.NewBatch()
+	for _, id := range ids {
+		batch.Delete(strconv.FormatInt(id, 10))
+	}
+
+	return b.index.Batch(batch)
+}
+
+func (b *BleveIndex) Search(ctx context.Context, text string, limit int) ([]Hit, error) {
+	analyzer := b.index.Mapping().AnalyzerNamed(en.AnalyzerName)
+	req := bleve.NewSearchRequestOptions(newQuery(text, analyzer), limit, 0, false)
+
+	res, err := b.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(res.Hits))
+	for _, match := range res.Hits {
+		id, err := strconv.ParseInt(match.ID, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, Hit{ID: id, Score: match.Score})
+	}
+
+	return hits, nil
+}
+
+func (b *BleveIndex) Close() error {
+	return b.index.Close()
+}
+
+// term is a word or quoted phrase of a search.
+type term struct {
+	text     string
+	phrase   bool
+	excluded bool
+}
+
+// newQuery reads the search like Postgres' websearch_to_tsquery does: the
+// terms must all match unless separated by OR, quoted phrases match as a
+// whole, and terms starting with - must not match. Words match despite a typo.
+// Terms the analyzer drops, like stop words, are ignored.
+func newQuery(text string, analyzer analysis.Analyzer) query.Query {
+	var (
+		alternatives []query.Query
+		excluded     []query.Query
+		conjuncts    []query.Query
+	)
+
+	for _, t := range splitTerms(text) {
+		switch {
+		case !t.phrase && t.text == "OR":
+			if len(conjuncts) > 0 {
+				alternatives = append(alternatives, bleve.NewConjunctionQuery(conjuncts...))
+				conjuncts = nil
+			}
+		case len(analyzer.Analyze([]byte(t.text))) == 0:
+			// nothing left to match
+		case t.excluded:
+			excluded = append(excluded, newTermQuery(t, 0))
+		default:
+			conjuncts = append(conjuncts, newTermQuery(t, 1))
+		}
+	}
+
+	if len(conjuncts) > 0 {
+		alternatives = append(alternatives, bleve.NewConjunctionQuery(conjuncts...))
+	}
+
+	if len(alternatives) == 0 {
+		return bleve.NewMatchNoneQuery()
+	}
+
+	q := bleve.NewBooleanQuery()
+	q.AddMust(bleve.NewDisjunctionQuery(alternatives...))
+	q.AddMustNot(excluded...)
+
+	return q
+}
+
+// newTermQuery matches the term in any of the searched fields.
+func newTermQuery(t term, fuzziness int) query.Query {
+	fields := make([]query.Query, 0, len(searchFields))
+	for _, field := range searchFields {
+		if t.phrase {
+			q := bleve.NewMatchPhraseQuery(t.text)
+			q.SetField(field.name)
+			q.SetBoost(field.boost)
+			fields = append(fields, q)
+			continue
+		}
+
+		q := bleve.NewMatchQuery(t.text)
+		q.SetField(field.name)
+		q.SetBoost(field.boost)
+		q.SetFuzziness(fuzziness)
+		fields = append(fields, q)
+	}
+
+	return bleve.NewDisjunctionQuery(fields...)
+}
+
+func splitTerms(text string) []term {
+	var terms []term
+
+	for {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			return terms
+		}
+
+		var t term
+		if strings.HasPrefix(text, "-") {
+			t.excluded = true
+			text = text[1:]
+		}
+
+		if rest, ok := strings.CutPrefix(text, `"`); ok {
+			t.phrase = true
+			t.text, text, _ = strings.Cut(rest, `"`)
+		} else {
+			end := strings.IndexFunc(text, unicode.IsSpace)
+			if end < 0 {
+				end = len(text)
+			}
+			t.text, text = text[:end], text[end:]
+		}
+
+		if strings.TrimSpace(t.text) != "" {
+			terms = append(terms, t)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package search
+
+import (
+	"context"
+
+	"github.com/edwrdc/digitally/internal/store"
+)
+
+// Index is a full-text index of the catalogue, searched in place of Postgres
+// when enabled. It only matches and ranks products; Postgres still filters and
+// pages them.
+type Index interface {
+	// Index adds the products to the index, replacing any indexed before.
+	Index(ctx context.Context, docs ...Document) error
+	Delete(ctx context.Context, ids ...int64) error
+	// Search returns up to limit products matching the query, most relevant
+	// first.
+	Search(ctx context.Context, query string, limit int) ([]Hit, error)
+	Close() error
+}
+
+// Document is what the index knows of a product.
+type Document struct {
+	ID          int64    `json:"-"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Categories  []string `json:"categories"`
+}
+
+type Hit struct {
+	ID    int64
+	Score float64
+}
+
+func NewDocument(product *store.Product) Document {
+	return Document{
+		ID:          product.ID,
+		Name:        product.Name,
+		Description: product.Description,
+		Categories:  product.Categories,
+	}
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type BillingAddress struct {
+	UserID     int64     `json:"user_id"`
+	Name       string    `json:"name"`
+	Line1      string    `json:"line1"`
+	Line2      string    `json:"line2"`
+	City       string    `json:"city"`
+	PostalCode string    `json:"postal_code"`
+	Country    string    `json:"country"`
+	VATID      string    `json:"vat_id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type BillingAddressStore struct {
+	db *sql.DB
+}
+
+func (s *BillingAddressStore) GetByUserID(ctx context.Context, userID int64) (*BillingAddress, error) {
+	query := `
+		SELECT user_id, name, line1, line2, city, postal_code, country, vat_id, updated_at
+		FROM billing_addresses
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var address BillingAddress
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&address.UserID,
+		&address.Name,
+		&address.Line1,
+		&address.Line2,
+		&address.City,
+		&address.PostalCode,
+		&address.Country,
+		&address.VATID,
+		&address.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &address, nil
+}
+
+func (s *BillingAddressStore) Upsert(ctx context.Context, address *BillingAddress) error {
+	query := `
+		INSERT INTO billing_addresses (user_id, name, line1, line2, city, postal_code, country, vat_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE
+		SET name = EXCLUDED.name, line1 = EXCLUDED.line1, line2 = EXCLUDED.line2, city = EXCLUDED.city,
+			postal_code = EXCLUDED.postal_code, country = EXCLUDED.country, vat_id = EXCLUDED.vat_id,
+			updated_at = NOW()
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		address.UserID,
+		address.Name,
+		address.Line1,
+		address.Line2,
+		address.City,
+		address.PostalCode,
+		address.Country,
+		address.VATID,
+	).Scan(&address.UpdatedAt)
+}
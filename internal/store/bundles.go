@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// BundleStore manages bundles: products sold at their own price that grant
+// several other products of the same seller.
+type BundleStore struct {
+	db *sql.DB
+}
+
+// Create stores the bundle as a product and links its member products. The
+// followers of the seller get a new product alert.
+func (s *BundleStore) Create(ctx context.Context, bundle *Product, productIDs []int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO products (user_id, name, price, description, categories, type, is_bundle)
+			VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'file'), TRUE)
+			RETURNING id, type, pricing_mode, is_bundle, created_at, updated_at
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			bundle.UserID,
+			bundle.Name,
+			bundle.Price,
+			bundle.Description,
+			pq.Array(bundle.Categories),
+			bundle.Type,
+		).Scan(&bundle.ID, &bundle.Type, &bundle.PricingMode, &bundle.IsBundle, &bundle.CreatedAt, &bundle.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		itemsQuery := `
+			INSERT INTO bundle_items (bundle_id, product_id)
+			SELECT $1, UNNEST($2::BIGINT[])
+		`
+
+		if _, err := tx.ExecContext(ctx, itemsQuery, bundle.ID, pq.Array(productIDs)); err != nil {
+			return err
+		}
+
+		return queueNewProductAlerts(ctx, tx, bundle)
+	})
+}
+
+func (s *BundleStore) GetProducts(ctx context.Context, bundleID int64) ([]Product, error) {
+	query := `
+		SELECT
+			p.id, p.user_id, p.name, p.price, p.pricing_mode, p.suggested_price, p.description, p.categories, p.type,
+			p.created_at, p.updated_at, p.version
+		FROM bundle_items bi
+		JOIN products p ON p.id = bi.product_id
+		WHERE bi.bundle_id = $1
+		ORDER BY p.id
+	`
+
+	return s.queryProducts(ctx, query, bundleID)
+}
+
+// GetByProductID returns the bundles the product is a member of.
+func (s *BundleStore) GetByProductID(ctx context.Context, productID int64) ([]Product, error) {
+	query := `
+		SELECT
+			p.id, p.user_id, p.name, p.price, p.pricing_mode, p.suggested_price, p.description, p.categories, p.type,
+			p.created_at, p.updated_at, p.version
+		FROM bundle_items bi
+		JOIN products p ON p.id = bi.bundle_id
+		WHERE bi.product_id = $1
+		ORDER BY p.id
+	`
+
+	products, err := s.queryProducts(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range products {
+		products[i].IsBundle = true
+	}
+
+	return products, nil
+}
+
+func (s *BundleStore) queryProducts(ctx context.Context, query string, args ...any) ([]Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make([]Product, 0)
+	for rows.Next() {
+		var product Product
+		if err := rows.Scan(
+			&product.ID,
+			&product.UserID,
+			&product.Name,
+			&product.Price,
+			&product.PricingMode,
+			&product.SuggestedPrice,
+			&product.Description,
+			pq.Array(&product.Categories),
+			&product.Type,
+			&product.CreatedAt,
+			&product.UpdatedAt,
+			&product.Version,
+		); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// grantedProductIDs expands a purchased product into the products it grants:
+// the members of a bundle, or the product itself.
+func grantedProductIDs(ctx context.Context, tx *sql.Tx, productID int64) ([]int64, error) {
+	query := `SELECT product_id FROM bundle_items WHERE bundle_id = $1 ORDER BY product_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		ids = []int64{productID}
+	}
+
+	return ids, nil
+}
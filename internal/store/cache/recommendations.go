@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// RecommendationStore caches the trending and related products between the
+// refreshes of the recommendations job.
+type RecommendationStore struct {
+	rdb *redis.Client
+}
+
+const RecommendationExpiryTime = 10 * time.Minute
+
+func (s *RecommendationStore) GetTrending(ctx context.Context) ([]store.RecommendedProduct, error) {
+	data, err := s.rdb.Get(ctx, "trending").Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var products []store.RecommendedProduct
+	if err := json.Unmarshal([]byte(data), &products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (s *RecommendationStore) SetTrending(ctx context.Context, products []store.RecommendedProduct) error {
+	json, err := json.Marshal(products)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEX(ctx, "trending", json, RecommendationExpiryTime).Err()
+}
+
+func (s *RecommendationStore) GetRelated(ctx context.Context, productID int64) (*store.RelatedProducts, error) {
+	data, err := s.rdb.Get(ctx, fmt.Sprintf("related-%d", productID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var related store.RelatedProducts
+	if err := json.Unmarshal([]byte(data), &related); err != nil {
+		return nil, err
+	}
+
+	return &related, nil
+}
+
+func (s *RecommendationStore) SetRelated(ctx context.Context, productID int64, related *store.RelatedProducts) error {
+	json, err := json.Marshal(related)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEX(ctx, fmt.Sprintf("related-%d", productID), json, RecommendationExpiryTime).Err()
+}
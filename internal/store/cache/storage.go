@@ -12,10 +12,23 @@ type Storage struct {
 		Get(context.Context, int64) (*store.User, error)
 		Set(context.Context, *store.User) error
 	}
+	Suggestions interface {
+		Get(ctx context.Context, prefix string) (*store.SearchSuggestions, error)
+		Set(ctx context.Context, prefix string, suggestions *store.SearchSuggestions) error
+		Hit(ctx context.Context, prefix string) (int64, error)
+	}
+	Recommendations interface {
+		GetTrending(context.Context) ([]store.RecommendedProduct, error)
+		SetTrending(context.Context, []store.RecommendedProduct) error
+		GetRelated(context.Context, int64) (*store.RelatedProducts, error)
+		SetRelated(context.Context, int64, *store.RelatedProducts) error
+	}
 }
 
 func NewRedisStorage(rdb *redis.Client) Storage {
 	return Storage{
-		Users: &UserStore{rdb},
+		Users:           &UserStore{rdb},
+		Suggestions:     &SuggestionStore{rdb},
+		Recommendations: &RecommendationStore{rdb},
 	}
 }
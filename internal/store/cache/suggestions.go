@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/edwrdc/digitally/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// SuggestionStore caches the suggestions of hot prefixes, those typed often.
+// Hits are counted over a window, so a prefix cools down once it stops being
+// typed.
+type SuggestionStore struct {
+	rdb *redis.Client
+}
+
+const (
+	SuggestionExpiryTime = 5 * time.Minute
+	SuggestionHitWindow  = time.Minute
+)
+
+func (s *SuggestionStore) Get(ctx context.Context, prefix string) (*store.SearchSuggestions, error) {
+	data, err := s.rdb.Get(ctx, "suggest-"+prefix).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var suggestions store.SearchSuggestions
+	if err := json.Unmarshal([]byte(data), &suggestions); err != nil {
+		return nil, err
+	}
+
+	return &suggestions, nil
+}
+
+func (s *SuggestionStore) Set(ctx context.Context, prefix string, suggestions *store.SearchSuggestions) error {
+	json, err := json.Marshal(suggestions)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEX(ctx, "suggest-"+prefix, json, SuggestionExpiryTime).Err()
+}
+
+// Hit counts a request for the prefix's suggestions, returning how many were
+// made within the current window.
+func (s *SuggestionStore) Hit(ctx context.Context, prefix string) (int64, error) {
+	cacheKey := "suggest-hits-" + prefix
+
+	hits, err := s.rdb.Incr(ctx, cacheKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if hits == 1 {
+		if err := s.rdb.Expire(ctx, cacheKey, SuggestionHitWindow).Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	return hits, nil
+}
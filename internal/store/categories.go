@@ -0,0 +1,319 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrCategoryInUse = errors.New("category has subcategories or products")
+	ErrCategoryCycle = errors.New("category cannot be moved under itself or its subcategories")
+)
+
+// Category is a node of the catalogue's taxonomy. Products refer to their
+// categories by slug, and filtering by a category includes its descendants.
+type Category struct {
+	ID          int64       `json:"id"`
+	ParentID    *int64      `json:"parent_id"`
+	Slug        string      `json:"slug"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	Children    []*Category `json:"children,omitempty"`
+}
+
+type CategoryStore struct {
+	db *sql.DB
+}
+
+const selectCategoryQuery = `
+	SELECT id, parent_id, slug, name, description, created_at, updated_at
+	FROM categories
+`
+
+func scanCategory(row interface{ Scan(...any) error }, category *Category) error {
+	return row.Scan(
+		&category.ID,
+		&category.ParentID,
+		&category.Slug,
+		&category.Name,
+		&category.Description,
+		&category.CreatedAt,
+		&category.UpdatedAt,
+	)
+}
+
+func (s *CategoryStore) GetByID(ctx context.Context, categoryID int64) (*Category, error) {
+	query := selectCategoryQuery + ` WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var category Category
+	if err := scanCategory(s.db.QueryRowContext(ctx, query, categoryID), &category); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &category, nil
+}
+
+// GetTree returns the top-level categories, each with its subcategories, by
+// name.
+func (s *CategoryStore) GetTree(ctx context.Context) ([]*Category, error) {
+	query := selectCategoryQuery + ` ORDER BY name, id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make([]*Category, 0)
+	for rows.Next() {
+		var category Category
+		if err := scanCategory(rows, &category); err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	roots := make([]*Category, 0)
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+			continue
+		}
+		parent := byID[*category.ParentID]
+		parent.Children = append(parent.Children, category)
+	}
+
+	return roots, nil
+}
+
+// GetUnknownSlugs returns the slugs no category has.
+func (s *CategoryStore) GetUnknownSlugs(ctx context.Context, slugs []string) ([]string, error) {
+	query := `
+		SELECT s.slug
+		FROM unnest($1::text[]) AS s(slug)
+		WHERE NOT EXISTS (SELECT 1 FROM categories c WHERE c.slug = s.slug)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(slugs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unknown := make([]string, 0)
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		unknown = append(unknown, slug)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return unknown, nil
+}
+
+// Create adds the category. ErrNotFound means its parent doesn't exist.
+func (s *CategoryStore) Create(ctx context.Context, category *Category) error {
+	query := `
+		INSERT INTO categories (parent_id, slug, name, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		category.ParentID,
+		category.Slug,
+		category.Name,
+		category.Description,
+	).Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "categories_slug_key"`:
+			return ErrConflict
+		case err.Error() == `pq: insert or update on table "categories" violates foreign key constraint "categories_parent_id_fkey"`:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update saves the category, renaming its slug on the products in it too, and
+// returns the IDs of the products renamed. ErrNotFound means the category or
+// its new parent doesn't exist.
+func (s *CategoryStore) Update(ctx context.Context, category *Category) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	productIDs := make([]int64, 0)
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var oldSlug string
+		err := tx.QueryRowContext(ctx, `SELECT slug FROM categories WHERE id = $1 FOR UPDATE`, category.ID).Scan(&oldSlug)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if category.ParentID != nil {
+			query := `
+				WITH RECURSIVE subtree AS (
+					SELECT id FROM categories WHERE id = $1
+					UNION ALL
+					SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+				)
+				SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+			`
+
+			var cycle bool
+			if err := tx.QueryRowContext(ctx, query, category.ID, *category.ParentID).Scan(&cycle); err != nil {
+				return err
+			}
+
+			if cycle {
+				return ErrCategoryCycle
+			}
+		}
+
+		query := `
+			UPDATE categories
+			SET parent_id = $1, slug = $2, name = $3, description = $4, updated_at = $5
+			WHERE id = $6
+			RETURNING updated_at
+		`
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			category.ParentID,
+			category.Slug,
+			category.Name,
+			category.Description,
+			time.Now().UTC(),
+			category.ID,
+		).Scan(&category.UpdatedAt)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "categories_slug_key"`:
+				return ErrConflict
+			case err.Error() == `pq: insert or update on table "categories" violates foreign key constraint "categories_parent_id_fkey"`:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if category.Slug == oldSlug {
+			return nil
+		}
+
+		query = `
+			UPDATE products
+			SET categories = array_replace(categories, $1, $2)
+			WHERE categories @> ARRAY[$1::text]
+			RETURNING id
+		`
+
+		rows, err := tx.QueryContext(ctx, query, oldSlug, category.Slug)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			productIDs = append(productIDs, id)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return productIDs, nil
+}
+
+// Delete removes the category. ErrCategoryInUse means it still has
+// subcategories or products.
+func (s *CategoryStore) Delete(ctx context.Context, categoryID int64) error {
+	query := `
+		DELETE FROM categories c
+		WHERE c.id = $1
+			AND NOT EXISTS (SELECT 1 FROM categories sub WHERE sub.parent_id = c.id)
+			AND NOT EXISTS (SELECT 1 FROM products p WHERE p.categories @> ARRAY[c.slug::text])
+		RETURNING c.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, query, categoryID).Scan(&id)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// nothing was deleted: either there was no such category or it is in use
+	var exists bool
+	err = s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)`, categoryID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrCategoryInUse
+	}
+
+	return ErrNotFound
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cursor is the position of an item in a keyset paginated listing: the values
+// of the active sort keys, then its creation time and id to break ties. Before
+// asks for the page ending right before the item instead of the one starting
+// after it. At pins the time sort keys depending on it were computed at, so
+// they don't drift between pages.
+type Cursor struct {
+	Sort      string     `json:"sort"`
+	Keys      []float64  `json:"keys,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ID        int64      `json:"id"`
+	Before    bool       `json:"before,omitempty"`
+	At        *time.Time `json:"at,omitempty"`
+}
+
+func (c *Cursor) values() []any {
+	values := make([]any, 0, len(c.Keys)+2)
+	for _, k := range c.Keys {
+		values = append(values, k)
+	}
+
+	return append(values, c.CreatedAt, c.ID)
+}
+
+// Page is a page of a keyset paginated listing with the cursors of the pages
+// around it. A nil cursor means there is no page that way.
+type Page[T any] struct {
+	Items []T
+	Next  *Cursor
+	Prev  *Cursor
+}
+
+// newPage trims the extra row fetched to tell whether the listing goes on,
+// restores the order of a backward page and points the cursors at the first
+// and last items. hasPrev tells whether there are items before the page when
+// paging forward.
+func newPage[T any](items []T, limit int, cursor *Cursor, hasPrev bool, cursorOf func(T) Cursor) *Page[T] {
+	backward := cursor != nil && cursor.Before
+
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	page := &Page[T]{Items: items}
+	if len(items) == 0 {
+		return page
+	}
+
+	if (backward && more) || (!backward && hasPrev) {
+		prev := cursorOf(items[0])
+		prev.Before = true
+		page.Prev = &prev
+	}
+
+	if backward || more {
+		next := cursorOf(items[len(items)-1])
+		page.Next = &next
+	}
+
+	return page
+}
+
+type keysetColumn struct {
+	expr string
+	desc bool
+}
+
+// keyset orders a listing by the sort key columns, then by the creation time
+// and the id, matching the values of its cursors. The sort names the listing
+// and its order, so cursors can't be carried over to another.
+type keyset struct {
+	sort    string
+	columns []keysetColumn
+}
+
+// cursor returns the cursor pointing at an item of the listing.
+func (k keyset) cursor(createdAt time.Time, id int64, keys ...float64) Cursor {
+	return Cursor{Sort: k.sort, Keys: keys, CreatedAt: createdAt, ID: id}
+}
+
+// orderBy returns the ORDER BY clause, reversed when paging backwards.
+func (k keyset) orderBy(backward bool) string {
+	columns := make([]string, len(k.columns))
+	for i, col := range k.columns {
+		dir := "ASC"
+		if col.desc != backward {
+			dir = "DESC"
+		}
+		columns[i] = col.expr + " " + dir
+	}
+
+	return " ORDER BY " + strings.Join(columns, ", ")
+}
+
+// after returns the condition picking the rows that come after the cursor, or
+// before it when paging backwards, appending its values to params.
+func (k keyset) after(cursor *Cursor, params []any) (string, []any, error) {
+	values := cursor.values()
+	if cursor.Sort != k.sort || len(values) != len(k.columns) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		params = append(params, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(params))
+	}
+
+	alternatives := make([]string, len(k.columns))
+	for i, col := range k.columns {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, fmt.Sprintf("%s = %s", k.columns[j].expr, placeholders[j]))
+		}
+
+		op := ">"
+		if col.desc != cursor.Before {
+			op = "<"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s %s", col.expr, op, placeholders[i]))
+
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+
+	return " AND (" + strings.Join(alternatives, " OR ") + ")", params, nil
+}
+
+// CursorCodec turns cursors into opaque tokens signed with a secret, so
+// clients can neither read nor forge them.
+type CursorCodec struct {
+	secret []byte
+}
+
+func NewCursorCodec(secret string) *CursorCodec {
+	return &CursorCodec{secret: []byte(secret)}
+}
+
+func (c *CursorCodec) Encode(cursor *Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+
+	data, _ := json.Marshal(cursor)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload))
+}
+
+// Decode checks the token's signature and returns its cursor, or
+// ErrInvalidCursor.
+func (c *CursorCodec) Decode(token string) (*Cursor, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, c.sign(payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+func (c *CursorCodec) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,326 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type EntitlementSource string
+
+const (
+	EntitlementSourcePurchase EntitlementSource = "purchase"
+	EntitlementSourceGift     EntitlementSource = "gift"
+	EntitlementSourceFree     EntitlementSource = "free"
+	EntitlementSourceAdmin    EntitlementSource = "admin"
+
+	EntitlementSourceSubscription EntitlementSource = "subscription"
+)
+
+// Entitlement grants a user access to a product. A nil Release means every
+// release of the product is accessible, a nil ExpiresAt means access never lapses.
+type Entitlement struct {
+	ID             int64             `json:"id"`
+	UserID         int64             `json:"user_id"`
+	ProductID      int64             `json:"product_id"`
+	Release        *string           `json:"release,omitempty"`
+	Source         EntitlementSource `json:"source"`
+	SubscriptionID *int64            `json:"subscription_id,omitempty"`
+	OrderID        *int64            `json:"order_id,omitempty"`
+	ExpiresAt      *time.Time        `json:"expires_at,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	Product        Product           `json:"product"`
+}
+
+type EntitlementStore struct {
+	db *sql.DB
+}
+
+// Grant gives the user permanent access to a product. An expiring entitlement
+// left by a subscription is upgraded, while ErrConflict means the user already
+// has permanent access.
+func (s *EntitlementStore) Grant(ctx context.Context, entitlement *Entitlement) error {
+	query := `
+		INSERT INTO entitlements (user_id, product_id, release, source)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT ON CONSTRAINT entitlements_user_product_release_key DO UPDATE
+		SET source = EXCLUDED.source, order_id = NULL, subscription_id = NULL, expires_at = NULL
+		WHERE entitlements.expires_at IS NOT NULL
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		entitlement.UserID,
+		entitlement.ProductID,
+		entitlement.Release,
+		entitlement.Source,
+	).Scan(&entitlement.ID, &entitlement.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *EntitlementStore) Revoke(ctx context.Context, userID, productID int64) error {
+	query := `DELETE FROM entitlements WHERE user_id = $1 AND product_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, productID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// IsOwned reports whether the user can access the product. A bundle counts as
+// owned once the user owns every product in it.
+func (s *EntitlementStore) IsOwned(ctx context.Context, userID, productID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM entitlements
+			WHERE user_id = $1 AND product_id = $2 AND (expires_at IS NULL OR expires_at > NOW())
+		) OR (
+			EXISTS (SELECT 1 FROM bundle_items WHERE bundle_id = $2)
+			AND NOT EXISTS (
+				SELECT 1 FROM bundle_items bi
+				WHERE bi.bundle_id = $2 AND NOT EXISTS (
+					SELECT 1 FROM entitlements e
+					WHERE e.user_id = $1 AND e.product_id = bi.product_id AND (e.expires_at IS NULL OR e.expires_at > NOW())
+				)
+			)
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var owned bool
+	if err := s.db.QueryRowContext(ctx, query, userID, productID).Scan(&owned); err != nil {
+		return false, err
+	}
+
+	return owned, nil
+}
+
+func (s *EntitlementStore) GetLibrary(ctx context.Context, userID int64, fq PaginationFeedQuery) ([]Entitlement, error) {
+	query := `
+		SELECT
+			e.id,
+			e.user_id,
+			e.product_id,
+			e.release,
+			e.source,
+			e.subscription_id,
+			e.order_id,
+			e.expires_at,
+			e.created_at,
+			p.user_id,
+			u.username AS seller_username,
+			p.name,
+			p.price,
+			p.description,
+			p.categories,
+			p.version,
+			p.created_at
+		FROM
+			entitlements e
+			INNER JOIN products p ON p.id = e.product_id
+			INNER JOIN users u ON u.id = p.user_id
+		WHERE e.user_id = $1 AND (e.expires_at IS NULL OR e.expires_at > NOW())
+	`
+	params := []interface{}{userID}
+	paramCount := 1
+
+	// Search Condition
+	if fq.Search != "" {
+		paramCount++
+		query += fmt.Sprintf(" AND (p.name ILIKE '%%' || $%d || '%%' OR p.description ILIKE '%%' || $%d || '%%')", paramCount, paramCount)
+		params = append(params, fq.Search)
+	}
+
+	// Categories Condition
+	if len(fq.Categories) > 0 {
+		paramCount++
+		query += fmt.Sprintf(" AND p.categories && $%d", paramCount)
+		params = append(params, pq.Array(fq.Categories))
+	}
+
+	// Date Range Condition, on the date the product was acquired
+	if fq.Since != nil {
+		paramCount++
+		query += fmt.Sprintf(" AND e.created_at >= $%d", paramCount)
+		params = append(params, fq.Since)
+	}
+
+	if fq.Until != nil {
+		paramCount++
+		query += fmt.Sprintf(" AND e.created_at <= $%d", paramCount)
+		params = append(params, fq.Until)
+	}
+
+	if fq.MinRating > 0 {
+		paramCount++
+		query += fmt.Sprintf(" AND p.rating_average >= $%d", paramCount)
+		params = append(params, fq.MinRating)
+	}
+
+	// ORDER BY and LIMIT
+	paramCount++
+	switch fq.Sort {
+	case SortByRating:
+		query += fmt.Sprintf(" ORDER BY p.rating_average DESC, p.rating_count DESC, e.created_at DESC, e.id DESC LIMIT $%d", paramCount)
+	default:
+		query += fmt.Sprintf(" ORDER BY e.created_at %s, e.id %s LIMIT $%d", fq.Sort, fq.Sort, paramCount)
+	}
+	params = append(params, fq.Limit)
+
+	paramCount++
+	query += fmt.Sprintf(" OFFSET $%d", paramCount)
+	params = append(params, fq.Offset)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	library := make([]Entitlement, 0)
+	for rows.Next() {
+		var e Entitlement
+		if err := rows.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.ProductID,
+			&e.Release,
+			&e.Source,
+			&e.SubscriptionID,
+			&e.OrderID,
+			&e.ExpiresAt,
+			&e.CreatedAt,
+			&e.Product.UserID,
+			&e.Product.User.Username,
+			&e.Product.Name,
+			&e.Product.Price,
+			&e.Product.Description,
+			pq.Array(&e.Product.Categories),
+			&e.Product.Version,
+			&e.Product.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		e.Product.ID = e.ProductID
+		e.Product.IsOwned = true
+		library = append(library, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return library, nil
+}
+
+// grantEntitlement gives the user permanent access to a product inside tx.
+// An expiring entitlement left by a subscription is upgraded, while an
+// existing permanent one is kept as it is.
+func grantEntitlement(ctx context.Context, tx *sql.Tx, entitlement *Entitlement) error {
+	query := `
+		INSERT INTO entitlements (user_id, product_id, release, source, order_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT ON CONSTRAINT entitlements_user_product_release_key DO UPDATE
+		SET source = EXCLUDED.source, order_id = EXCLUDED.order_id, subscription_id = NULL, expires_at = NULL
+		WHERE entitlements.expires_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(
+		ctx,
+		query,
+		entitlement.UserID,
+		entitlement.ProductID,
+		entitlement.Release,
+		entitlement.Source,
+		entitlement.OrderID,
+	)
+
+	return err
+}
+
+// syncSubscriptionEntitlement grants or extends the entitlement backing a
+// subscription so that it lapses at expiresAt, or later when another of the
+// user's subscriptions to the product gives access for longer: the one
+// entitlement lapses with the last of them. Entitlements that never expire,
+// such as a previous purchase, are left untouched.
+func syncSubscriptionEntitlement(ctx context.Context, tx *sql.Tx, sub *Subscription, productID int64, expiresAt time.Time) error {
+	// the other subscriptions' access mirrors Subscription.AccessUntil
+	query := `
+		WITH access AS (
+			SELECT $4::bigint AS subscription_id, $5::timestamptz AS expires_at
+			UNION ALL
+			SELECT s.id,
+				CASE s.status
+					WHEN 'past_due' THEN COALESCE(s.grace_until, s.current_period_end)
+					ELSE s.current_period_end
+				END
+			FROM subscriptions s
+			JOIN subscription_plans sp ON sp.id = s.plan_id
+			WHERE s.user_id = $1 AND sp.product_id = $2 AND s.id <> $4 AND s.status <> 'expired'
+		)
+		INSERT INTO entitlements (user_id, product_id, source, subscription_id, expires_at)
+		SELECT $1, $2, $3, subscription_id, expires_at
+		FROM access
+		ORDER BY expires_at DESC
+		LIMIT 1
+		ON CONFLICT ON CONSTRAINT entitlements_user_product_release_key DO UPDATE
+		SET source = EXCLUDED.source, subscription_id = EXCLUDED.subscription_id, expires_at = EXCLUDED.expires_at
+		WHERE entitlements.expires_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(
+		ctx,
+		query,
+		sub.UserID,
+		productID,
+		EntitlementSourceSubscription,
+		sub.ID,
+		expiresAt,
+	)
+
+	return err
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+type GiftStatus string
+
+const (
+	GiftStatusPending  GiftStatus = "pending"
+	GiftStatusRedeemed GiftStatus = "redeemed"
+)
+
+// Gift is a paid order whose product goes to someone else. The product is
+// only granted once the recipient redeems the emailed token.
+type Gift struct {
+	ID             int64      `json:"id"`
+	OrderID        int64      `json:"order_id"`
+	PurchaserID    int64      `json:"purchaser_id"`
+	ProductID      int64      `json:"product_id"`
+	ProductName    string     `json:"product_name"`
+	RecipientEmail string     `json:"recipient_email"`
+	Message        string     `json:"message"`
+	Token          string     `json:"-"`
+	Status         GiftStatus `json:"status"`
+	RecipientID    *int64     `json:"recipient_id"`
+	RedeemedAt     *time.Time `json:"redeemed_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type GiftStore struct {
+	db *sql.DB
+}
+
+const selectGiftQuery = `
+	SELECT
+		g.id, g.order_id, g.purchaser_id, g.product_id, p.name, g.recipient_email, g.message,
+		g.status, g.recipient_id, g.redeemed_at, g.created_at
+	FROM gifts g
+	JOIN products p ON p.id = g.product_id
+`
+
+func scanGift(row interface{ Scan(...any) error }, gift *Gift) error {
+	return row.Scan(
+		&gift.ID,
+		&gift.OrderID,
+		&gift.PurchaserID,
+		&gift.ProductID,
+		&gift.ProductName,
+		&gift.RecipientEmail,
+		&gift.Message,
+		&gift.Status,
+		&gift.RecipientID,
+		&gift.RedeemedAt,
+		&gift.CreatedAt,
+	)
+}
+
+// createGift records the gift of a paid order. The token must already be hashed.
+func createGift(ctx context.Context, tx *sql.Tx, gift *Gift) error {
+	query := `
+		INSERT INTO gifts (order_id, purchaser_id, product_id, recipient_email, message, token)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		gift.OrderID,
+		gift.PurchaserID,
+		gift.ProductID,
+		gift.RecipientEmail,
+		gift.Message,
+		gift.Token,
+	).Scan(&gift.ID, &gift.Status, &gift.CreatedAt)
+}
+
+func (s *GiftStore) GetByID(ctx context.Context, giftID int64) (*Gift, error) {
+	query := selectGiftQuery + ` WHERE g.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var gift Gift
+	if err := scanGift(s.db.QueryRowContext(ctx, query, giftID), &gift); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &gift, nil
+}
+
+// GetByToken looks a gift up by the plain redeem token sent to the recipient.
+func (s *GiftStore) GetByToken(ctx context.Context, token string) (*Gift, error) {
+	query := selectGiftQuery + ` WHERE g.token = $1`
+
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var gift Gift
+	if err := scanGift(s.db.QueryRowContext(ctx, query, hashToken), &gift); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &gift, nil
+}
+
+func (s *GiftStore) GetByPurchaserID(ctx context.Context, userID int64) ([]Gift, error) {
+	query := selectGiftQuery + `
+		WHERE g.purchaser_id = $1
+		ORDER BY g.created_at DESC, g.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gifts := make([]Gift, 0)
+	for rows.Next() {
+		var gift Gift
+		if err := scanGift(rows, &gift); err != nil {
+			return nil, err
+		}
+		gifts = append(gifts, gift)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return gifts, nil
+}
+
+// Redeem hands the gifted product to the recipient. It returns ErrConflict when
+// the gift has already been redeemed.
+func (s *GiftStore) Redeem(ctx context.Context, gift *Gift, recipientID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE gifts
+			SET status = $1, recipient_id = $2, redeemed_at = $3
+			WHERE id = $4 AND status = $5
+			RETURNING status, recipient_id, redeemed_at
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			GiftStatusRedeemed,
+			recipientID,
+			time.Now().UTC(),
+			gift.ID,
+			GiftStatusPending,
+		).Scan(&gift.Status, &gift.RecipientID, &gift.RedeemedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrConflict
+			default:
+				return err
+			}
+		}
+
+		productIDs, err := grantedProductIDs(ctx, tx, gift.ProductID)
+		if err != nil {
+			return err
+		}
+
+		for _, productID := range productIDs {
+			entitlement := &Entitlement{
+				UserID:    recipientID,
+				ProductID: productID,
+				Source:    EntitlementSourceGift,
+				OrderID:   &gift.OrderID,
+			}
+			if err := grantEntitlement(ctx, tx, entitlement); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
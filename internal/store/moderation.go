@@ -0,0 +1,385 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type ReportReason string
+
+const (
+	ReportReasonSpam      ReportReason = "spam"
+	ReportReasonOffensive ReportReason = "offensive"
+	ReportReasonFake      ReportReason = "fake"
+	ReportReasonOffTopic  ReportReason = "off_topic"
+	ReportReasonOther     ReportReason = "other"
+)
+
+type ReportStatus string
+
+const (
+	ReportStatusOpen      ReportStatus = "open"
+	ReportStatusResolved  ReportStatus = "resolved"
+	ReportStatusDismissed ReportStatus = "dismissed"
+)
+
+// Report is a user flagging either a review or a product for moderators.
+type Report struct {
+	ID         int64        `json:"id"`
+	ReporterID int64        `json:"reporter_id"`
+	ReviewID   *int64       `json:"review_id"`
+	ProductID  *int64       `json:"product_id"`
+	Reason     ReportReason `json:"reason"`
+	Details    string       `json:"details"`
+	Status     ReportStatus `json:"status"`
+	ResolvedBy *int64       `json:"resolved_by"`
+	ResolvedAt *time.Time   `json:"resolved_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// ModerationAction is an entry of the audit trail of moderator decisions.
+type ModerationAction struct {
+	ID          int64     `json:"id"`
+	ModeratorID *int64    `json:"moderator_id"`
+	ReviewID    *int64    `json:"review_id"`
+	ReportID    *int64    `json:"report_id"`
+	Action      string    `json:"action"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// QueuedReview is a review waiting for a moderator, either because the filter
+// held it or because users reported it.
+type QueuedReview struct {
+	Review
+	OpenReports int `json:"open_reports"`
+}
+
+// reviewActions names the audit trail action of each moderation decision.
+var reviewActions = map[ReviewStatus]string{
+	ReviewStatusApproved: "approve",
+	ReviewStatusRejected: "reject",
+	ReviewStatusHidden:   "hide",
+}
+
+type ModerationStore struct {
+	db *sql.DB
+}
+
+func (s *ModerationStore) CreateReport(ctx context.Context, report *Report) error {
+	query := `
+		INSERT INTO reports (reporter_id, review_id, product_id, reason, details)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		report.ReporterID,
+		report.ReviewID,
+		report.ProductID,
+		report.Reason,
+		report.Details,
+	).Scan(&report.ID, &report.Status, &report.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reports_open_review_key"`:
+			return ErrConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "reports_open_product_key"`:
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ModerationStore) GetReportByID(ctx context.Context, reportID int64) (*Report, error) {
+	query := `
+		SELECT id, reporter_id, review_id, product_id, reason, details, status, resolved_by, resolved_at, created_at
+		FROM reports
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var report Report
+	if err := scanReport(s.db.QueryRowContext(ctx, query, reportID), &report); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
+
+// GetReports lists the reports with the given status, oldest first.
+func (s *ModerationStore) GetReports(ctx context.Context, status ReportStatus, fq PaginationFeedQuery) ([]Report, error) {
+	query := `
+		SELECT id, reporter_id, review_id, product_id, reason, details, status, resolved_by, resolved_at, created_at
+		FROM reports
+		WHERE status = $1
+		ORDER BY created_at ASC, id ASC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, status, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]Report, 0)
+	for rows.Next() {
+		var report Report
+		if err := scanReport(rows, &report); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// GetQueue lists the reviews waiting for a moderator: pending ones first, then
+// the most reported.
+func (s *ModerationStore) GetQueue(ctx context.Context, fq PaginationFeedQuery) ([]QueuedReview, error) {
+	query := `
+		SELECT
+			r.id, r.user_id, r.product_id, r.rating, r.comment, r.verified_purchase, r.helpful_count, r.status,
+			r.created_at, r.updated_at, users.username, users.id, COUNT(rp.id) AS open_reports
+		FROM reviews r
+		JOIN users ON users.id = r.user_id
+		LEFT JOIN reports rp ON rp.review_id = r.id AND rp.status = 'open'
+		WHERE r.status IN ('pending', 'approved')
+		GROUP BY r.id, users.id
+		HAVING r.status = 'pending' OR COUNT(rp.id) > 0
+		ORDER BY r.status = 'pending' DESC, open_reports DESC, r.created_at ASC
+		LIMIT $1 OFFSET $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queue := make([]QueuedReview, 0)
+	for rows.Next() {
+		var q QueuedReview
+		if err := rows.Scan(
+			&q.ID,
+			&q.UserID,
+			&q.ProductID,
+			&q.Rating,
+			&q.Comment,
+			&q.VerifiedPurchase,
+			&q.HelpfulCount,
+			&q.Status,
+			&q.CreatedAt,
+			&q.UpdatedAt,
+			&q.User.Username,
+			&q.User.ID,
+			&q.OpenReports,
+		); err != nil {
+			return nil, err
+		}
+		queue = append(queue, q)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// ModerateReview sets the status of a review and closes its open reports:
+// approving a review dismisses them, rejecting or hiding it resolves them.
+// The decision is recorded in the audit trail.
+func (s *ModerationStore) ModerateReview(ctx context.Context, reviewID, moderatorID int64, status ReviewStatus, note string) error {
+	action, ok := reviewActions[status]
+	if !ok {
+		return errors.New("invalid review status")
+	}
+
+	reportStatus := ReportStatusResolved
+	if status == ReviewStatusApproved {
+		reportStatus = ReportStatusDismissed
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `UPDATE reviews SET status = $2 WHERE id = $1`, reviewID, status)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		reportsQuery := `
+			UPDATE reports
+			SET status = $2, resolved_by = $3, resolved_at = NOW()
+			WHERE review_id = $1 AND status = 'open'
+		`
+
+		if _, err := tx.ExecContext(ctx, reportsQuery, reviewID, reportStatus, moderatorID); err != nil {
+			return err
+		}
+
+		return logModerationAction(ctx, tx, &ModerationAction{
+			ModeratorID: &moderatorID,
+			ReviewID:    &reviewID,
+			Action:      action,
+			Note:        note,
+		})
+	})
+}
+
+// ResolveReport closes an open report, recording the decision in the audit
+// trail.
+func (s *ModerationStore) ResolveReport(ctx context.Context, report *Report, moderatorID int64, status ReportStatus, note string) error {
+	action := "resolve"
+	if status == ReportStatusDismissed {
+		action = "dismiss"
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE reports
+			SET status = $2, resolved_by = $3, resolved_at = NOW()
+			WHERE id = $1 AND status = 'open'
+			RETURNING status, resolved_by, resolved_at
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, report.ID, status, moderatorID).Scan(
+			&report.Status,
+			&report.ResolvedBy,
+			&report.ResolvedAt,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		return logModerationAction(ctx, tx, &ModerationAction{
+			ModeratorID: &moderatorID,
+			ReviewID:    report.ReviewID,
+			ReportID:    &report.ID,
+			Action:      action,
+			Note:        note,
+		})
+	})
+}
+
+// GetActions lists the audit trail, latest first.
+func (s *ModerationStore) GetActions(ctx context.Context, fq PaginationFeedQuery) ([]ModerationAction, error) {
+	query := `
+		SELECT id, moderator_id, review_id, report_id, action, note, created_at
+		FROM moderation_actions
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := make([]ModerationAction, 0)
+	for rows.Next() {
+		var a ModerationAction
+		if err := rows.Scan(
+			&a.ID,
+			&a.ModeratorID,
+			&a.ReviewID,
+			&a.ReportID,
+			&a.Action,
+			&a.Note,
+			&a.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+func logModerationAction(ctx context.Context, tx *sql.Tx, action *ModerationAction) error {
+	query := `
+		INSERT INTO moderation_actions (moderator_id, review_id, report_id, action, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		action.ModeratorID,
+		action.ReviewID,
+		action.ReportID,
+		action.Action,
+		action.Note,
+	).Scan(&action.ID, &action.CreatedAt)
+}
+
+func scanReport(row interface{ Scan(...any) error }, report *Report) error {
+	return row.Scan(
+		&report.ID,
+		&report.ReporterID,
+		&report.ReviewID,
+		&report.ProductID,
+		&report.Reason,
+		&report.Details,
+		&report.Status,
+		&report.ResolvedBy,
+		&report.ResolvedAt,
+		&report.CreatedAt,
+	)
+}
@@ -0,0 +1,439 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type PriceAlertKind string
+
+const (
+	PriceAlertKindPriceDrop PriceAlertKind = "price_drop"
+	PriceAlertKindSale      PriceAlertKind = "sale"
+)
+
+// NotificationPreferences are the alerts a user wants about their wishlist and
+// the sellers they follow. The unsubscribe token lets them turn every alert
+// off from the digest email without signing in.
+type NotificationPreferences struct {
+	UserID           int64      `json:"user_id"`
+	PriceDropAlerts  bool       `json:"price_drop_alerts"`
+	SaleAlerts       bool       `json:"sale_alerts"`
+	NewProductAlerts bool       `json:"new_product_alerts"`
+	UnsubscribeToken string     `json:"-"`
+	LastDigestAt     *time.Time `json:"last_digest_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// PriceAlert tells a user that a wishlisted product got cheaper.
+type PriceAlert struct {
+	ID          int64          `json:"id"`
+	UserID      int64          `json:"user_id"`
+	ProductID   int64          `json:"product_id"`
+	ProductName string         `json:"product_name"`
+	Kind        PriceAlertKind `json:"kind"`
+	OldPrice    float64        `json:"old_price"`
+	NewPrice    float64        `json:"new_price"`
+	SaleEndsAt  *time.Time     `json:"sale_ends_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// NewProductAlert tells a user that a seller they follow published a product.
+type NewProductAlert struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	ProductID      int64     `json:"product_id"`
+	ProductName    string    `json:"product_name"`
+	SellerUsername string    `json:"seller_username"`
+	Price          float64   `json:"price"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Digest gathers the alerts due to a user. Alerts that went stale, because
+// the price went back up, the sale ended or the user stopped following the
+// seller, are left out.
+type Digest struct {
+	UserID           int64
+	Username         string
+	Email            string
+	UnsubscribeToken string
+	Alerts           []PriceAlert
+	NewProducts      []NewProductAlert
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+const selectNotificationPreferencesQuery = `
+	SELECT user_id, price_drop_alerts, sale_alerts, new_product_alerts, unsubscribe_token, last_digest_at, updated_at
+	FROM notification_preferences
+`
+
+// GetPreferences returns the user's preferences, creating the defaults the
+// first time.
+func (s *NotificationStore) GetPreferences(ctx context.Context, userID int64) (*NotificationPreferences, error) {
+	query := `
+		INSERT INTO notification_preferences (user_id)
+		VALUES ($1)
+		ON CONFLICT (user_id) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, query, userID); err != nil {
+		return nil, err
+	}
+
+	var prefs NotificationPreferences
+	err := scanNotificationPreferences(s.db.QueryRowContext(ctx, selectNotificationPreferencesQuery+`WHERE user_id = $1`, userID), &prefs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &prefs, nil
+}
+
+func (s *NotificationStore) UpdatePreferences(ctx context.Context, prefs *NotificationPreferences) error {
+	query := `
+		UPDATE notification_preferences
+		SET price_drop_alerts = $2, sale_alerts = $3, new_product_alerts = $4, updated_at = NOW()
+		WHERE user_id = $1
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, prefs.UserID, prefs.PriceDropAlerts, prefs.SaleAlerts, prefs.NewProductAlerts).Scan(&prefs.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Unsubscribe turns off every alert of the user holding the token.
+func (s *NotificationStore) Unsubscribe(ctx context.Context, token string) error {
+	query := `
+		UPDATE notification_preferences
+		SET price_drop_alerts = FALSE, sale_alerts = FALSE, new_product_alerts = FALSE, updated_at = NOW()
+		WHERE unsubscribe_token = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, token)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetDueDigests returns up to limit users who have alerts waiting and weren't
+// sent a digest since the given time. Their alerts are gathered by
+// ProcessDigest, once the user has been claimed.
+func (s *NotificationStore) GetDueDigests(ctx context.Context, now, lastDigestBefore time.Time, limit int) ([]Digest, error) {
+	query := `
+		SELECT np.user_id, u.username, u.email, np.unsubscribe_token
+		FROM notification_preferences np
+		JOIN users u ON u.id = np.user_id
+		WHERE (np.last_digest_at IS NULL OR np.last_digest_at <= $2)
+			AND (
+				EXISTS (
+					SELECT 1 FROM price_alerts a
+					WHERE a.user_id = np.user_id AND a.sent_at IS NULL AND a.available_at <= $1
+				)
+				OR EXISTS (
+					SELECT 1 FROM new_product_alerts a
+					WHERE a.user_id = np.user_id AND a.sent_at IS NULL
+				)
+			)
+		ORDER BY np.user_id
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, now, lastDigestBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	digests := make([]Digest, 0)
+	for rows.Next() {
+		var d Digest
+		if err := rows.Scan(&d.UserID, &d.Username, &d.Email, &d.UnsubscribeToken); err != nil {
+			return nil, err
+		}
+		digests = append(digests, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return digests, nil
+}
+
+// ProcessDigest claims the user's digest, gathers its alerts and hands it to
+// send when there is anything in it, then closes the alerts it was built from,
+// stale ones included. The user stays locked until then, so that other
+// instances skip them, and a failed send leaves the alerts for the next run.
+// ErrNotFound means the digest was already claimed or is no longer due.
+func (s *NotificationStore) ProcessDigest(ctx context.Context, digest *Digest, now, lastDigestBefore time.Time, send func(*Digest) error) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT user_id
+			FROM notification_preferences
+			WHERE user_id = $1 AND (last_digest_at IS NULL OR last_digest_at <= $2)
+			FOR UPDATE SKIP LOCKED
+		`
+
+		queryCtx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var userID int64
+		if err := tx.QueryRowContext(queryCtx, query, digest.UserID, lastDigestBefore).Scan(&userID); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := loadDigestAlerts(ctx, tx, digest, now); err != nil {
+			return err
+		}
+
+		sent := len(digest.Alerts) > 0 || len(digest.NewProducts) > 0
+		if sent {
+			if err := send(digest); err != nil {
+				return err
+			}
+		}
+
+		return markDigestSent(ctx, tx, digest.UserID, now, sent)
+	})
+}
+
+// loadDigestAlerts gathers the alerts of the digest that are still worth
+// sending.
+func loadDigestAlerts(ctx context.Context, tx *sql.Tx, digest *Digest, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	alertsQuery := `
+		SELECT a.id, a.user_id, a.product_id, p.name, a.kind, a.old_price, a.new_price, p.sale_ends_at, a.created_at
+		FROM price_alerts a
+		JOIN products p ON p.id = a.product_id
+		JOIN notification_preferences np ON np.user_id = a.user_id
+		WHERE a.user_id = $2
+			AND a.sent_at IS NULL
+			AND a.available_at <= $1
+			AND (
+				(a.kind = 'price_drop' AND np.price_drop_alerts AND p.price < a.old_price)
+				OR (a.kind = 'sale' AND np.sale_alerts AND p.sale_price IS NOT NULL AND p.sale_starts_at <= $1 AND p.sale_ends_at > $1)
+			)
+		ORDER BY a.created_at
+	`
+
+	alertRows, err := tx.QueryContext(ctx, alertsQuery, now, digest.UserID)
+	if err != nil {
+		return err
+	}
+	defer alertRows.Close()
+
+	digest.Alerts = nil
+	for alertRows.Next() {
+		var a PriceAlert
+		if err := alertRows.Scan(
+			&a.ID,
+			&a.UserID,
+			&a.ProductID,
+			&a.ProductName,
+			&a.Kind,
+			&a.OldPrice,
+			&a.NewPrice,
+			&a.SaleEndsAt,
+			&a.CreatedAt,
+		); err != nil {
+			return err
+		}
+		digest.Alerts = append(digest.Alerts, a)
+	}
+
+	if err := alertRows.Err(); err != nil {
+		return err
+	}
+
+	newProductsQuery := `
+		SELECT a.id, a.user_id, a.product_id, p.name, u.username, p.price, a.created_at
+		FROM new_product_alerts a
+		JOIN products p ON p.id = a.product_id
+		JOIN users u ON u.id = p.user_id
+		JOIN notification_preferences np ON np.user_id = a.user_id
+		WHERE a.user_id = $1
+			AND a.sent_at IS NULL
+			AND np.new_product_alerts
+			AND EXISTS (SELECT 1 FROM seller_follows f WHERE f.follower_id = a.user_id AND f.seller_id = p.user_id)
+		ORDER BY a.created_at
+	`
+
+	newProductRows, err := tx.QueryContext(ctx, newProductsQuery, digest.UserID)
+	if err != nil {
+		return err
+	}
+	defer newProductRows.Close()
+
+	digest.NewProducts = nil
+	for newProductRows.Next() {
+		var a NewProductAlert
+		if err := newProductRows.Scan(
+			&a.ID,
+			&a.UserID,
+			&a.ProductID,
+			&a.ProductName,
+			&a.SellerUsername,
+			&a.Price,
+			&a.CreatedAt,
+		); err != nil {
+			return err
+		}
+		digest.NewProducts = append(digest.NewProducts, a)
+	}
+
+	return newProductRows.Err()
+}
+
+// markDigestSent closes the user's alerts. The digest time is only recorded
+// when there was something to send.
+func markDigestSent(ctx context.Context, tx *sql.Tx, userID int64, now time.Time, sent bool) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		UPDATE price_alerts
+		SET sent_at = $2
+		WHERE user_id = $1 AND sent_at IS NULL AND available_at <= $2
+	`
+
+	if _, err := tx.ExecContext(ctx, query, userID, now); err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE new_product_alerts
+		SET sent_at = $2
+		WHERE user_id = $1 AND sent_at IS NULL AND created_at <= $2
+	`
+
+	if _, err := tx.ExecContext(ctx, query, userID, now); err != nil {
+		return err
+	}
+
+	if !sent {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE notification_preferences SET last_digest_at = $2 WHERE user_id = $1`, userID, now)
+
+	return err
+}
+
+// queuePriceAlerts queues an alert for every user who wishlisted the product
+// and wants alerts of that kind. A pending alert of the same kind is updated
+// instead, keeping the price the user last heard of.
+func queuePriceAlerts(ctx context.Context, tx *sql.Tx, productID int64, kind PriceAlertKind, oldPrice, newPrice float64, availableAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	prefsQuery := `
+		INSERT INTO notification_preferences (user_id)
+		SELECT user_id FROM user_wishlist WHERE product_id = $1
+		ON CONFLICT (user_id) DO NOTHING
+	`
+
+	if _, err := tx.ExecContext(ctx, prefsQuery, productID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO price_alerts (user_id, product_id, kind, old_price, new_price, available_at)
+		SELECT w.user_id, w.product_id, $2, $3, $4, $5
+		FROM user_wishlist w
+		JOIN notification_preferences np ON np.user_id = w.user_id
+		WHERE w.product_id = $1
+			AND CASE WHEN $2 = 'sale' THEN np.sale_alerts ELSE np.price_drop_alerts END
+		ON CONFLICT (user_id, product_id, kind) WHERE sent_at IS NULL
+		DO UPDATE SET new_price = EXCLUDED.new_price, available_at = EXCLUDED.available_at
+	`
+
+	_, err := tx.ExecContext(ctx, query, productID, kind, oldPrice, newPrice, availableAt)
+
+	return err
+}
+
+// queueNewProductAlerts queues an alert of the new product for every follower
+// of its seller who wants them.
+func queueNewProductAlerts(ctx context.Context, tx *sql.Tx, product *Product) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	prefsQuery := `
+		INSERT INTO notification_preferences (user_id)
+		SELECT follower_id FROM seller_follows WHERE seller_id = $1
+		ON CONFLICT (user_id) DO NOTHING
+	`
+
+	if _, err := tx.ExecContext(ctx, prefsQuery, product.UserID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO new_product_alerts (user_id, product_id)
+		SELECT f.follower_id, $2
+		FROM seller_follows f
+		JOIN notification_preferences np ON np.user_id = f.follower_id
+		WHERE f.seller_id = $1 AND np.new_product_alerts
+		ON CONFLICT (user_id, product_id) DO NOTHING
+	`
+
+	_, err := tx.ExecContext(ctx, query, product.UserID, product.ID)
+
+	return err
+}
+
+func scanNotificationPreferences(row interface{ Scan(...any) error }, prefs *NotificationPreferences) error {
+	return row.Scan(
+		&prefs.UserID,
+		&prefs.PriceDropAlerts,
+		&prefs.SaleAlerts,
+		&prefs.NewProductAlerts,
+		&prefs.UnsubscribeToken,
+		&prefs.LastDigestAt,
+		&prefs.UpdatedAt,
+	)
+}
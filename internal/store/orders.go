@@ -0,0 +1,742 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatusPending OrderStatus = "pending"
+	OrderStatusPaid    OrderStatus = "paid"
+	OrderStatusFailed  OrderStatus = "failed"
+
+	// the payment was taken but the order could not be completed, then it
+	// was refunded, or the refund failed too and is left to be done by hand
+	OrderStatusRefunded    OrderStatus = "refunded"
+	OrderStatusUnfulfilled OrderStatus = "unfulfilled"
+)
+
+type Order struct {
+	ID               int64          `json:"id"`
+	UserID           int64          `json:"user_id"`
+	SellerID         int64          `json:"seller_id"`
+	Status           OrderStatus    `json:"status"`
+	Subtotal         float64        `json:"subtotal"`
+	TaxTotal         float64        `json:"tax_total"`
+	Total            float64        `json:"total"`
+	BillingCountry   *string        `json:"billing_country"`
+	BillingAddress   *PostalAddress `json:"billing_address,omitempty"`
+	BuyerVATID       string         `json:"buyer_vat_id,omitempty"`
+	ReverseCharge    bool           `json:"reverse_charge"`
+	PaymentReference string         `json:"-"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	Items            []OrderItem    `json:"items"`
+	TaxLines         []OrderTaxLine `json:"tax_lines"`
+	Invoice          *Invoice       `json:"invoice,omitempty"`
+	// Gift is set when the order was bought for someone else.
+	Gift *Gift `json:"gift,omitempty"`
+}
+
+type OrderItem struct {
+	ID        int64   `json:"id"`
+	OrderID   int64   `json:"order_id"`
+	ProductID *int64  `json:"product_id"`
+	Name      string  `json:"name"`
+	UnitPrice float64 `json:"unit_price"`
+	Quantity  int     `json:"quantity"`
+}
+
+type OrderTaxLine struct {
+	ID            int64   `json:"id"`
+	OrderID       int64   `json:"order_id"`
+	Name          string  `json:"name"`
+	Country       string  `json:"country"`
+	Rate          float64 `json:"rate"`
+	TaxableAmount float64 `json:"taxable_amount"`
+	Amount        float64 `json:"amount"`
+}
+
+// Invoice is issued once an order is paid. Seller and buyer details are copied
+// at issue time so the invoice never changes afterwards.
+type Invoice struct {
+	ID          int64     `json:"id"`
+	OrderID     int64     `json:"order_id"`
+	SellerID    int64     `json:"seller_id"`
+	Number      int64     `json:"number"`
+	SellerName  string    `json:"seller_name"`
+	SellerEmail string    `json:"seller_email"`
+	BuyerName   string    `json:"buyer_name"`
+	BuyerEmail  string    `json:"buyer_email"`
+	IssuedAt    time.Time `json:"issued_at"`
+	// SellerAddress holds the seller's legal name and address, taken from
+	// their billing address. It is nil when they had none.
+	SellerAddress *PostalAddress `json:"seller_address,omitempty"`
+	SellerVATID   string         `json:"seller_vat_id,omitempty"`
+}
+
+// PostalAddress is an address copied onto an order or invoice, so it keeps
+// showing what it was at the time.
+type PostalAddress struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country"`
+}
+
+// addressColumns receives the columns of a copied address. Rows written before
+// addresses were copied have them empty.
+type addressColumns struct {
+	name, line1, line2, city, postalCode sql.NullString
+}
+
+func (c *addressColumns) address(country *string) *PostalAddress {
+	if c.line1.String == "" || country == nil {
+		return nil
+	}
+
+	return &PostalAddress{
+		Name:       c.name.String,
+		Line1:      c.line1.String,
+		Line2:      c.line2.String,
+		City:       c.city.String,
+		PostalCode: c.postalCode.String,
+		Country:    *country,
+	}
+}
+
+type OrderStore struct {
+	db *sql.DB
+}
+
+// Create stores a pending order with its items, before any payment is taken.
+func (s *OrderStore) Create(ctx context.Context, order *Order) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO orders (
+				user_id, seller_id, subtotal, tax_total, total, billing_country, buyer_vat_id, reverse_charge,
+				billing_name, billing_line1, billing_line2, billing_city, billing_postal_code
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id, status, created_at, updated_at
+		`
+
+		var billing PostalAddress
+		if order.BillingAddress != nil {
+			billing = *order.BillingAddress
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			order.UserID,
+			order.SellerID,
+			order.Subtotal,
+			order.TaxTotal,
+			order.Total,
+			order.BillingCountry,
+			order.BuyerVATID,
+			order.ReverseCharge,
+			billing.Name,
+			billing.Line1,
+			billing.Line2,
+			billing.City,
+			billing.PostalCode,
+		).Scan(&order.ID, &order.Status, &order.CreatedAt, &order.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		for i := range order.Items {
+			if err := s.createItem(ctx, tx, order.ID, &order.Items[i]); err != nil {
+				return err
+			}
+		}
+
+		for i := range order.TaxLines {
+			if err := s.createTaxLine(ctx, tx, order.ID, &order.TaxLines[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *OrderStore) createItem(ctx context.Context, tx *sql.Tx, orderID int64, item *OrderItem) error {
+	query := `
+		INSERT INTO order_items (order_id, product_id, name, unit_price, quantity)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if item.Quantity == 0 {
+		item.Quantity = 1
+	}
+	item.OrderID = orderID
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		orderID,
+		item.ProductID,
+		item.Name,
+		item.UnitPrice,
+		item.Quantity,
+	).Scan(&item.ID)
+}
+
+func (s *OrderStore) createTaxLine(ctx context.Context, tx *sql.Tx, orderID int64, line *OrderTaxLine) error {
+	query := `
+		INSERT INTO order_tax_lines (order_id, name, country, rate, taxable_amount, amount)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	line.OrderID = orderID
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		orderID,
+		line.Name,
+		line.Country,
+		line.Rate,
+		line.TaxableAmount,
+		line.Amount,
+	).Scan(&line.ID)
+}
+
+// Complete marks the order as paid, grants the purchased products (the members
+// of a bundle) to the buyer and issues the seller's next invoice number, all in
+// one transaction. Gift orders record the gift instead of granting anything to
+// the buyer, and free claims are not invoiced.
+func (s *OrderStore) Complete(ctx context.Context, order *Order, paymentReference string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE orders
+			SET status = $1, payment_reference = $2, updated_at = $3
+			WHERE id = $4 AND status = $5
+			RETURNING status, updated_at
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			OrderStatusPaid,
+			paymentReference,
+			time.Now().UTC(),
+			order.ID,
+			OrderStatusPending,
+		).Scan(&order.Status, &order.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+		order.PaymentReference = paymentReference
+
+		if order.Gift != nil {
+			order.Gift.OrderID = order.ID
+			order.Gift.PurchaserID = order.UserID
+			if err := createGift(ctx, tx, order.Gift); err != nil {
+				return err
+			}
+		} else {
+			for _, item := range order.Items {
+				if item.ProductID == nil {
+					continue
+				}
+
+				productIDs, err := grantedProductIDs(ctx, tx, *item.ProductID)
+				if err != nil {
+					return err
+				}
+
+				source := EntitlementSourcePurchase
+				if order.Total == 0 {
+					source = EntitlementSourceFree
+				}
+
+				for _, productID := range productIDs {
+					entitlement := &Entitlement{
+						UserID:    order.UserID,
+						ProductID: productID,
+						Source:    source,
+						OrderID:   &order.ID,
+					}
+					if err := grantEntitlement(ctx, tx, entitlement); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		// nothing was sold, so free claims do not use up an invoice number
+		if order.Total == 0 {
+			return nil
+		}
+
+		invoice, err := s.issueInvoice(ctx, tx, order)
+		if err != nil {
+			return err
+		}
+		order.Invoice = invoice
+
+		return nil
+	})
+}
+
+func (s *OrderStore) issueInvoice(ctx context.Context, tx *sql.Tx, order *Order) (*Invoice, error) {
+	// the row lock taken by the upsert serialises concurrent invoices of the
+	// same seller, and a rolled back transaction gives its number back
+	sequenceQuery := `
+		INSERT INTO invoice_sequences (seller_id, last_number)
+		VALUES ($1, 1)
+		ON CONFLICT (seller_id) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+		RETURNING last_number
+	`
+
+	invoice := &Invoice{
+		OrderID:  order.ID,
+		SellerID: order.SellerID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if err := tx.QueryRowContext(ctx, sequenceQuery, order.SellerID).Scan(&invoice.Number); err != nil {
+		return nil, err
+	}
+
+	// the seller's legal details come from their billing address, which
+	// sellers without one have not set yet
+	invoiceQuery := `
+		INSERT INTO invoices (
+			order_id, seller_id, number, seller_name, seller_email, buyer_name, buyer_email,
+			seller_legal_name, seller_line1, seller_line2, seller_city, seller_postal_code, seller_country, seller_vat_id
+		)
+		SELECT
+			$1, $2, $3, seller.username, seller.email, buyer.username, buyer.email,
+			COALESCE(sa.name, ''), COALESCE(sa.line1, ''), COALESCE(sa.line2, ''), COALESCE(sa.city, ''),
+			COALESCE(sa.postal_code, ''), sa.country, COALESCE(sa.vat_id, '')
+		FROM users seller
+		JOIN users buyer ON buyer.id = $4
+		LEFT JOIN billing_addresses sa ON sa.user_id = seller.id
+		WHERE seller.id = $2
+		RETURNING
+			id, seller_name, seller_email, buyer_name, buyer_email, issued_at,
+			seller_legal_name, seller_line1, seller_line2, seller_city, seller_postal_code, seller_country, seller_vat_id
+	`
+
+	var (
+		sellerAddress addressColumns
+		sellerCountry *string
+	)
+
+	err := tx.QueryRowContext(
+		ctx,
+		invoiceQuery,
+		order.ID,
+		order.SellerID,
+		invoice.Number,
+		order.UserID,
+	).Scan(
+		&invoice.ID,
+		&invoice.SellerName,
+		&invoice.SellerEmail,
+		&invoice.BuyerName,
+		&invoice.BuyerEmail,
+		&invoice.IssuedAt,
+		&sellerAddress.name,
+		&sellerAddress.line1,
+		&sellerAddress.line2,
+		&sellerAddress.city,
+		&sellerAddress.postalCode,
+		&sellerCountry,
+		&invoice.SellerVATID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	invoice.SellerAddress = sellerAddress.address(sellerCountry)
+
+	return invoice, nil
+}
+
+func (s *OrderStore) MarkFailed(ctx context.Context, order *Order) error {
+	query := `
+		UPDATE orders SET status = $1, updated_at = $2
+		WHERE id = $3 AND status = $4
+		RETURNING status, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		OrderStatusFailed,
+		time.Now().UTC(),
+		order.ID,
+		OrderStatusPending,
+	).Scan(&order.Status, &order.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarkNotCompleted records that the order was paid for but could not be
+// completed, with the status it was left in and the payment it was charged.
+func (s *OrderStore) MarkNotCompleted(ctx context.Context, order *Order, status OrderStatus, paymentReference string) error {
+	query := `
+		UPDATE orders SET status = $1, payment_reference = $2, updated_at = $3
+		WHERE id = $4 AND status = $5
+		RETURNING status, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		status,
+		paymentReference,
+		time.Now().UTC(),
+		order.ID,
+		OrderStatusPending,
+	).Scan(&order.Status, &order.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	order.PaymentReference = paymentReference
+
+	return nil
+}
+
+func (s *OrderStore) GetByID(ctx context.Context, orderID int64) (*Order, error) {
+	query := `
+		SELECT
+			o.id, o.user_id, o.seller_id, o.status, o.subtotal, o.tax_total, o.total,
+			o.billing_country, o.buyer_vat_id, o.reverse_charge, o.payment_reference, o.created_at, o.updated_at,
+			o.billing_name, o.billing_line1, o.billing_line2, o.billing_city, o.billing_postal_code,
+			i.id, i.number, i.seller_name, i.seller_email, i.buyer_name, i.buyer_email, i.issued_at,
+			i.seller_legal_name, i.seller_line1, i.seller_line2, i.seller_city, i.seller_postal_code,
+			i.seller_country, i.seller_vat_id
+		FROM orders o
+		LEFT JOIN invoices i ON i.order_id = o.id
+		WHERE o.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var (
+		order       Order
+		invoiceID   sql.NullInt64
+		number      sql.NullInt64
+		sellerName  sql.NullString
+		sellerEmail sql.NullString
+		buyerName   sql.NullString
+		buyerEmail  sql.NullString
+		issuedAt    sql.NullTime
+
+		billing       addressColumns
+		sellerAddress addressColumns
+		sellerCountry *string
+		sellerVATID   sql.NullString
+	)
+
+	err := s.db.QueryRowContext(ctx, query, orderID).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.SellerID,
+		&order.Status,
+		&order.Subtotal,
+		&order.TaxTotal,
+		&order.Total,
+		&order.BillingCountry,
+		&order.BuyerVATID,
+		&order.ReverseCharge,
+		&order.PaymentReference,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+		&billing.name,
+		&billing.line1,
+		&billing.line2,
+		&billing.city,
+		&billing.postalCode,
+		&invoiceID,
+		&number,
+		&sellerName,
+		&sellerEmail,
+		&buyerName,
+		&buyerEmail,
+		&issuedAt,
+		&sellerAddress.name,
+		&sellerAddress.line1,
+		&sellerAddress.line2,
+		&sellerAddress.city,
+		&sellerAddress.postalCode,
+		&sellerCountry,
+		&sellerVATID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	order.BillingAddress = billing.address(order.BillingCountry)
+
+	if invoiceID.Valid {
+		order.Invoice = &Invoice{
+			ID:            invoiceID.Int64,
+			OrderID:       order.ID,
+			SellerID:      order.SellerID,
+			Number:        number.Int64,
+			SellerName:    sellerName.String,
+			SellerEmail:   sellerEmail.String,
+			BuyerName:     buyerName.String,
+			BuyerEmail:    buyerEmail.String,
+			IssuedAt:      issuedAt.Time,
+			SellerAddress: sellerAddress.address(sellerCountry),
+			SellerVATID:   sellerVATID.String,
+		}
+	}
+
+	orders := []*Order{&order}
+	if err := s.loadItems(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	gift, err := s.getGift(ctx, order.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	order.Gift = gift
+
+	return &order, nil
+}
+
+func (s *OrderStore) getGift(ctx context.Context, orderID int64) (*Gift, error) {
+	query := selectGiftQuery + ` WHERE g.order_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var gift Gift
+	if err := scanGift(s.db.QueryRowContext(ctx, query, orderID), &gift); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &gift, nil
+}
+
+func (s *OrderStore) GetByUserID(ctx context.Context, userID int64) ([]Order, error) {
+	query := `
+		SELECT
+			id, user_id, seller_id, status, subtotal, tax_total, total,
+			billing_country, buyer_vat_id, reverse_charge, payment_reference, created_at, updated_at,
+			billing_name, billing_line1, billing_line2, billing_city, billing_postal_code
+		FROM orders
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]Order, 0)
+	for rows.Next() {
+		var (
+			order   Order
+			billing addressColumns
+		)
+		if err := rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.SellerID,
+			&order.Status,
+			&order.Subtotal,
+			&order.TaxTotal,
+			&order.Total,
+			&order.BillingCountry,
+			&order.BuyerVATID,
+			&order.ReverseCharge,
+			&order.PaymentReference,
+			&order.CreatedAt,
+			&order.UpdatedAt,
+			&billing.name,
+			&billing.line1,
+			&billing.line2,
+			&billing.city,
+			&billing.postalCode,
+		); err != nil {
+			return nil, err
+		}
+		order.BillingAddress = billing.address(order.BillingCountry)
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ptrs := make([]*Order, len(orders))
+	for i := range orders {
+		ptrs[i] = &orders[i]
+	}
+
+	if err := s.loadItems(ctx, ptrs); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (s *OrderStore) loadItems(ctx context.Context, orders []*Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT id, order_id, product_id, name, unit_price, quantity
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY id
+	`
+
+	ids := make([]int64, len(orders))
+	byID := make(map[int64]*Order, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+		byID[order.ID] = order
+		order.Items = make([]OrderItem, 0)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item OrderItem
+		if err := rows.Scan(
+			&item.ID,
+			&item.OrderID,
+			&item.ProductID,
+			&item.Name,
+			&item.UnitPrice,
+			&item.Quantity,
+		); err != nil {
+			return err
+		}
+
+		order := byID[item.OrderID]
+		order.Items = append(order.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return s.loadTaxLines(ctx, ids, byID)
+}
+
+func (s *OrderStore) loadTaxLines(ctx context.Context, ids []int64, byID map[int64]*Order) error {
+	query := `
+		SELECT id, order_id, name, country, rate, taxable_amount, amount
+		FROM order_tax_lines
+		WHERE order_id = ANY($1)
+		ORDER BY id
+	`
+
+	for _, order := range byID {
+		order.TaxLines = make([]OrderTaxLine, 0)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line OrderTaxLine
+		if err := rows.Scan(
+			&line.ID,
+			&line.OrderID,
+			&line.Name,
+			&line.Country,
+			&line.Rate,
+			&line.TaxableAmount,
+			&line.Amount,
+		); err != nil {
+			return err
+		}
+
+		order := byID[line.OrderID]
+		order.TaxLines = append(order.TaxLines, line)
+	}
+
+	return rows.Err()
+}
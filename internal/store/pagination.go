@@ -1,20 +1,46 @@
 package store
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	// SortByRating orders the best rated products first.
+	SortByRating = "rating"
+	// SortByNewest, SortByPrice, SortByWishlisted and SortByBestSelling are
+	// the fields the feed can be sorted by, in the order of the query's sort.
+	SortByNewest      = "newest"
+	SortByPrice       = "price"
+	SortByWishlisted  = "wishlisted"
+	SortByBestSelling = "best_selling"
+	// SortRecommended orders the feed by how well products match the user.
+	SortRecommended = "recommended"
+	// SortByRelevance orders the products best matching the search first.
+	SortByRelevance = "relevance"
+)
+
 type PaginationFeedQuery struct {
 	Limit      int      `json:"limit" validate:"gte=1,lte=20"`
 	Offset     int      `json:"offset" validate:"gte=0"`
-	Sort       string   `json:"sort" validate:"oneof=asc desc"`
+	Sort       string   `json:"sort" validate:"oneof=asc desc rating recommended relevance"`
+	SortBy     string   `json:"sort_by" validate:"omitempty,oneof=newest price rating wishlisted best_selling"`
 	Categories []string `json:"categories" validate:"max=5"`
 	Search     string   `json:"search" validate:"max=100"`
 	Since      *string  `json:"since"`
 	Until      *string  `json:"until"`
+	MinRating  float64  `json:"min_rating" validate:"gte=0,lte=5"`
+	MinPrice   float64  `json:"min_price" validate:"gte=0"`
+	MaxPrice   *float64 `json:"max_price" validate:"omitempty,gte=0"`
+	Seller     string   `json:"seller" validate:"max=100"`
+	Type       string   `json:"type" validate:"omitempty,oneof=file service item"`
+	Following  bool     `json:"following"`
+	Cursor     *Cursor  `json:"-"`
+	// Matches are what the search index found for the search, if enabled.
+	Matches *SearchMatches `json:"-"`
 }
 
 func (fq PaginationFeedQuery) Parse(r *http.Request) (PaginationFeedQuery, error) {
@@ -43,12 +69,27 @@ func (fq PaginationFeedQuery) Parse(r *http.Request) (PaginationFeedQuery, error
 		fq.Sort = sort
 	}
 
+	// sorting by a field takes the direction from sort, the cheapest first
+	// for the price and the highest first otherwise
+	sortBy := qs.Get("sort_by")
+	if sortBy != "" {
+		fq.SortBy = sortBy
+		switch {
+		case sort == "" && sortBy == SortByPrice:
+			fq.Sort = "asc"
+		case sort == "":
+			fq.Sort = "desc"
+		case sort != "asc" && sort != "desc":
+			return fq, errors.New("sort must be asc or desc when sorting by a field")
+		}
+	}
+
 	categories := qs.Get("categories")
 	if categories != "" {
 		rawCategories := strings.Split(categories, ",")
 		cleanCategories := make([]string, 0, len(rawCategories))
 		for _, cat := range rawCategories {
-			cat = strings.TrimSpace(cat)
+			cat = strings.ToLower(strings.TrimSpace(cat))
 			if cat != "" {
 				cleanCategories = append(cleanCategories, cat)
 			}
@@ -58,6 +99,55 @@ func (fq PaginationFeedQuery) Parse(r *http.Request) (PaginationFeedQuery, error
 		}
 	}
 
+	minRating := qs.Get("min_rating")
+	if minRating != "" {
+		m, err := strconv.ParseFloat(minRating, 64)
+		if err != nil {
+			return fq, err
+		}
+		fq.MinRating = m
+	}
+
+	minPrice := qs.Get("min_price")
+	if minPrice != "" {
+		m, err := strconv.ParseFloat(minPrice, 64)
+		if err != nil {
+			return fq, err
+		}
+		fq.MinPrice = m
+	}
+
+	maxPrice := qs.Get("max_price")
+	if maxPrice != "" {
+		m, err := strconv.ParseFloat(maxPrice, 64)
+		if err != nil {
+			return fq, err
+		}
+		if m < fq.MinPrice {
+			return fq, errors.New("max_price must not be lower than min_price")
+		}
+		fq.MaxPrice = &m
+	}
+
+	seller := qs.Get("seller")
+	if seller != "" {
+		fq.Seller = strings.TrimSpace(seller)
+	}
+
+	productType := qs.Get("type")
+	if productType != "" {
+		fq.Type = productType
+	}
+
+	following := qs.Get("following")
+	if following != "" {
+		f, err := strconv.ParseBool(following)
+		if err != nil {
+			return fq, err
+		}
+		fq.Following = f
+	}
+
 	search := qs.Get("search")
 	if search != "" {
 		fq.Search = strings.TrimSpace(search)
@@ -89,3 +179,59 @@ func (fq PaginationFeedQuery) Parse(r *http.Request) (PaginationFeedQuery, error
 
 	return fq, nil
 }
+
+// Review sort orders.
+const (
+	ReviewSortNewest  = "newest"
+	ReviewSortHighest = "highest"
+	ReviewSortLowest  = "lowest"
+	ReviewSortHelpful = "helpful"
+)
+
+// ReviewQuery pages through a product's reviews with a cursor taken from the
+// previous page.
+type ReviewQuery struct {
+	Limit        int     `json:"limit" validate:"gte=1,lte=50"`
+	Sort         string  `json:"sort" validate:"oneof=newest highest lowest helpful"`
+	Rating       int     `json:"rating" validate:"gte=0,lte=5"`
+	VerifiedOnly bool    `json:"verified_only"`
+	Cursor       *Cursor `json:"-"`
+}
+
+func (rq ReviewQuery) Parse(r *http.Request) (ReviewQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return rq, err
+		}
+		rq.Limit = l
+	}
+
+	sort := qs.Get("sort")
+	if sort != "" {
+		rq.Sort = sort
+	}
+
+	rating := qs.Get("rating")
+	if rating != "" {
+		n, err := strconv.Atoi(rating)
+		if err != nil {
+			return rq, err
+		}
+		rq.Rating = n
+	}
+
+	verified := qs.Get("verified_only")
+	if verified != "" {
+		v, err := strconv.ParseBool(verified)
+		if err != nil {
+			return rq, err
+		}
+		rq.VerifiedOnly = v
+	}
+
+	return rq, nil
+}
@@ -5,39 +5,355 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/lib/pq"
 )
 
+type PricingMode string
+
+const (
+	PricingModeFixed          PricingMode = "fixed"
+	PricingModePayWhatYouWant PricingMode = "pwyw"
+	PricingModeFree           PricingMode = "free"
+)
+
+// ProductSale lowers the price of a fixed price product for a while.
+type ProductSale struct {
+	Price    float64   `json:"price"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// Product is a digital good listed by a seller. For pay what you want products
+// Price is the minimum the buyer must pay. Bundles list the products they grant
+// in BundleProducts. WishlistCount is only meant for the seller.
 type Product struct {
-	ID          int64    `json:"id"`
-	UserID      int64    `json:"user_id"`
-	Name        string   `json:"name"`
-	Price       float64  `json:"price"`
-	Description string   `json:"description"`
-	Categories  []string `json:"categories"`
-	// TODO: Type - {Service, Item, File}
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	Version   int            `json:"version"`
-	Reviews   []Review       `json:"reviews,omitempty"`
-	User      User           `json:"user,omitempty"`
-	Wishlist  []UserWishlist `json:"wishlist,omitempty"`
+	ID             int64          `json:"id"`
+	UserID         int64          `json:"user_id"`
+	Name           string         `json:"name"`
+	Price          float64        `json:"price"`
+	PricingMode    PricingMode    `json:"pricing_mode"`
+	SuggestedPrice *float64       `json:"suggested_price,omitempty"`
+	Description    string         `json:"description"`
+	Categories     []string       `json:"categories"`
+	Type           string         `json:"type"`
+	IsBundle       bool           `json:"is_bundle"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	Version        int            `json:"version"`
+	Reviews        []Review       `json:"reviews,omitempty"`
+	User           User           `json:"user,omitempty"`
+	Wishlist       []UserWishlist `json:"wishlist,omitempty"`
+	IsOwned        bool           `json:"is_owned"`
+	Rating         RatingSummary  `json:"rating"`
+	BundleProducts []Product      `json:"bundle_products,omitempty"`
+	WishlistCount  *int           `json:"wishlist_count,omitempty"`
+	Sale           *ProductSale   `json:"sale,omitempty"`
+}
+
+// CurrentPrice is the price of the product at the given time, taking a running
+// sale into account.
+func (p *Product) CurrentPrice(at time.Time) float64 {
+	if p.Sale != nil && !at.Before(p.Sale.StartsAt) && at.Before(p.Sale.EndsAt) && p.Sale.Price < p.Price {
+		return p.Sale.Price
+	}
+
+	return p.Price
 }
 
 type UserFeedProduct struct {
 	Product
-	ReviewCount  int  `json:"review_count"`
-	IsWishlisted bool `json:"is_wishlisted"`
+	ReviewCount   int               `json:"review_count"`
+	IsWishlisted  bool              `json:"is_wishlisted"`
+	Highlights    *SearchHighlights `json:"highlights,omitempty"`
+	score         float64
+	salesCount    int
+	wishlistCount int
+}
+
+// sortKeys returns the values of the product's sort_by keys, as its cursors
+// hold them.
+func (p UserFeedProduct) sortKeys(sortBy string) []float64 {
+	switch sortBy {
+	case SortByPrice:
+		return []float64{p.Price}
+	case SortByRating:
+		return []float64{p.Rating.Average, float64(p.Rating.Count)}
+	case SortByWishlisted:
+		return []float64{float64(p.wishlistCount)}
+	case SortByBestSelling:
+		return []float64{float64(p.salesCount)}
+	default:
+		return nil
+	}
+}
+
+// SearchHighlights show where a product matched the search: the terms found
+// are wrapped in <mark> tags, and the rest of the text is HTML escaped.
+type SearchHighlights struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SearchMatches are the products a search index matched, which the feed
+// filters and ranks in place of the Postgres full-text search. The scores line
+// up with the IDs.
+type SearchMatches struct {
+	IDs    []int64
+	Scores []float64
+}
+
+// FeedRanking weighs the signals of the recommended feed. A product scores
+// FollowedWeight when the user follows its seller, up to CategoryWeight as its
+// categories overlap those of the products the user wishlisted or bought, and
+// up to RecencyWeight for new products, halving every RecencyHalfLife.
+type FeedRanking struct {
+	FollowedWeight  float64
+	CategoryWeight  float64
+	RecencyWeight   float64
+	RecencyHalfLife time.Duration
+}
+
+// feedRankScore scores a feed product with the weights of a FeedRanking in
+// $2 to $5 for the user in $1, as of the time in $6.
+const feedRankScore = `(
+	$2::float8 * (EXISTS (
+		SELECT 1 FROM seller_follows f WHERE f.follower_id = $1 AND f.seller_id = p.user_id
+	))::int
+	+ $3::float8 * (
+		SELECT COUNT(*) FROM unnest(p.categories) AS c(category)
+		WHERE c.category IN (
+			SELECT unnest(ip.categories) FROM products ip
+			WHERE ip.id IN (
+				SELECT product_id FROM user_wishlist WHERE user_id = $1
+				UNION
+				SELECT product_id FROM entitlements WHERE user_id = $1
+			)
+		)
+	)::float8 / GREATEST(cardinality(p.categories), 1)
+	+ $4::float8 * POWER(0.5, EXTRACT(EPOCH FROM $6::timestamptz - p.created_at) / $5::float8))`
+
+// feedSearchMatch picks the products matching the search in $%[1]d, with
+// trigram similarity catching the typos full-text search misses.
+const feedSearchMatch = `(
+	p.search_vector @@ websearch_to_tsquery('english', $%[1]d)
+	OR p.name %% $%[1]d
+	OR $%[1]d <%% p.description
+)`
+
+// feedRelevanceScore scores how well a product matches the search in $%[1]d.
+const feedRelevanceScore = `(
+	ts_rank_cd(p.search_vector, websearch_to_tsquery('english', $%[1]d)) + similarity(p.name, $%[1]d)
+)`
+
+// feedCategoryMatch picks the products in any of the categories in $%[1]d, or
+// their subcategories.
+const feedCategoryMatch = `p.categories && ARRAY(
+	WITH RECURSIVE tree AS (
+		SELECT id, slug FROM categories WHERE slug = ANY($%[1]d)
+		UNION ALL
+		SELECT c.id, c.slug FROM categories c JOIN tree t ON c.parent_id = t.id
+	)
+	SELECT slug::text FROM tree
+)`
+
+// feedIndexMatch picks the products the search index matched, whose IDs are in
+// $%[1]d.
+const feedIndexMatch = `p.id = ANY($%[1]d::bigint[])`
+
+// feedIndexScore scores the products as the search index did, the scores in
+// $%[2]d lining up with the IDs in $%[1]d.
+const feedIndexScore = `COALESCE(($%[2]d::float8[])[array_position($%[1]d::bigint[], p.id)], 0)`
+
+// feedSearchHeadline highlights the search in $%[1]d within the text %[2]s,
+// escaping it first as the marks are HTML.
+const feedSearchHeadline = `ts_headline(
+	'english',
+	replace(replace(replace(%[2]s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+	websearch_to_tsquery('english', $%[1]d),
+	'StartSel=<mark>, StopSel=</mark>, %[3]s'
+)`
+
+// feedKeysets orders the feed for each sort. The relevance keyset is completed
+// with the search parameter.
+var feedKeysets = map[string]keyset{
+	"asc": {sort: "feed:asc", columns: []keysetColumn{
+		{"p.created_at", false}, {"p.id", false},
+	}},
+	"desc": {sort: "feed:desc", columns: []keysetColumn{
+		{"p.created_at", true}, {"p.id", true},
+	}},
+	SortByRating: {sort: "feed:" + SortByRating, columns: []keysetColumn{
+		{"p.rating_average", true}, {"p.rating_count", true}, {"p.created_at", true}, {"p.id", true},
+	}},
+	SortRecommended: {sort: "feed:" + SortRecommended, columns: []keysetColumn{
+		{feedRankScore, true}, {"p.created_at", true}, {"p.id", true},
+	}},
+	SortByRelevance: {sort: "feed:" + SortByRelevance, columns: []keysetColumn{
+		{feedRelevanceScore, true}, {"p.created_at", true}, {"p.id", true},
+	}},
+}
+
+// feedSortColumns whitelists the columns the feed can be sorted by, so
+// sort_by never reaches the query itself. Each has an index ending with the
+// creation time and id the keyset breaks ties on.
+var feedSortColumns = map[string][]string{
+	SortByNewest:      nil,
+	SortByPrice:       {"p.price"},
+	SortByRating:      {"p.rating_average", "p.rating_count"},
+	SortByWishlisted:  {"p.wishlist_count"},
+	SortByBestSelling: {"p.sales_count"},
+}
+
+// sortByKeyset orders the feed by the sort_by field in the direction of sort,
+// asc or desc.
+func sortByKeyset(sortBy, sort string) (keyset, bool) {
+	columns, ok := feedSortColumns[sortBy]
+	if !ok {
+		return keyset{}, false
+	}
+
+	desc := sort != "asc"
+	order := keyset{sort: "feed:" + sortBy + ":" + sort}
+	for _, col := range columns {
+		order.columns = append(order.columns, keysetColumn{col, desc})
+	}
+	order.columns = append(order.columns, keysetColumn{"p.created_at", desc}, keysetColumn{"p.id", desc})
+
+	return order, true
 }
 
+// SearchFacets count the products matching a search by category, type, seller
+// and price range.
+type SearchFacets struct {
+	Categories  []FacetCount      `json:"categories"`
+	Types       []FacetCount      `json:"types"`
+	Sellers     []FacetCount      `json:"sellers"`
+	PriceRanges []PriceRangeCount `json:"price_ranges"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// PriceRangeCount counts the products priced from Min up to, but excluding,
+// Max. The free products have a range of their own, where Max is 0, and the
+// last range has no Max.
+type PriceRangeCount struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int      `json:"count"`
+}
+
+// SearchSuggestions complete a search being typed with product names,
+// categories and sellers.
+type SearchSuggestions struct {
+	Products   []ProductSuggestion  `json:"products"`
+	Categories []CategorySuggestion `json:"categories"`
+	Sellers    []SellerSuggestion   `json:"sellers"`
+}
+
+type ProductSuggestion struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type CategorySuggestion struct {
+	ID    int64  `json:"id"`
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type SellerSuggestion struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// facetLimit caps the categories and sellers counted, keeping the most common.
+const facetLimit = 10
+
+// priceRangeBounds split the paid products into price ranges.
+var priceRangeBounds = []float64{5, 10, 25, 50, 100}
+
 type ProductStore struct {
 	db *sql.DB
 }
 
-func (s *ProductStore) GetUserFeed(ctx context.Context, userID int64, fq PaginationFeedQuery) ([]UserFeedProduct, error) {
+// GetUserFeed returns a page of the feed as seen by the user. The query's
+// cursor takes over its offset. Recommended pages are ranked as of the time
+// the first page was, so the scores don't drift while scrolling. Searching
+// highlights the matches, found by the search index when the query has its
+// matches; without a search, sorting by relevance falls back to the latest
+// products. Sorting by a field orders on it in the direction of the sort.
+// A zero user ID is an anonymous visitor, who owns, wishlists and follows
+// nothing.
+func (s *ProductStore) GetUserFeed(ctx context.Context, userID int64, fq PaginationFeedQuery, ranking FeedRanking) (*Page[UserFeedProduct], error) {
+	sort := fq.Sort
+	if sort == SortByRelevance && fq.Search == "" {
+		sort = "desc"
+	}
+
+	order, ok := feedKeysets[sort]
+	if fq.SortBy != "" {
+		order, ok = sortByKeyset(fq.SortBy, sort)
+	}
+	if !ok {
+		order = feedKeysets["desc"]
+	}
+
+	params := []interface{}{userID}
+	paramCount := 1
+
+	// The ranking weights are only bound when ranking, as unused parameters
+	// have no type Postgres can infer.
+	score := "0"
+	rankedAt := time.Now().UTC().Truncate(time.Second)
+	if sort == SortRecommended {
+		if fq.Cursor != nil && fq.Cursor.At != nil {
+			rankedAt = *fq.Cursor.At
+		}
+		score = feedRankScore
+		params = append(params, ranking.FollowedWeight, ranking.CategoryWeight, ranking.RecencyWeight, ranking.RecencyHalfLife.Seconds(), rankedAt)
+		paramCount += 5
+	}
+
+	// Search highlights and relevance
+	highlights := "NULL::text, NULL::text"
+	searchParam, matchParam := 0, 0
+	if fq.Search != "" {
+		paramCount++
+		params = append(params, fq.Search)
+		searchParam = paramCount
+
+		highlights = fmt.Sprintf(feedSearchHeadline, searchParam, "p.name", "HighlightAll=true") + ", " +
+			fmt.Sprintf(feedSearchHeadline, searchParam, "p.description", "MaxFragments=2, MaxWords=30, MinWords=10")
+
+		if fq.Matches != nil {
+			paramCount++
+			params = append(params, pq.Array(fq.Matches.IDs))
+			matchParam = paramCount
+		}
+
+		if sort == SortByRelevance && fq.SortBy == "" {
+			if fq.Matches != nil {
+				paramCount++
+				params = append(params, pq.Array(fq.Matches.Scores))
+				score = fmt.Sprintf(feedIndexScore, matchParam, paramCount)
+			} else {
+				score = fmt.Sprintf(feedRelevanceScore, searchParam)
+			}
+			order.columns = append([]keysetColumn{{score, true}}, order.columns[1:]...)
+		}
+	}
+
 	query := `
 		SELECT
 			p.id AS product_id,
@@ -45,73 +361,75 @@ func (s *ProductStore) GetUserFeed(ctx context.Context, userID int64, fq Paginat
 			u.username AS seller_username,
 			p.name,
 			p.price,
+			p.pricing_mode,
+			p.suggested_price,
 			p.description,
 			p.categories,
+			p.type,
+			p.is_bundle,
 			p.version,
 			p.created_at,
-			COALESCE(COUNT(r.id), 0) AS reviews_count,
-			CASE WHEN w.product_id IS NOT NULL THEN true ELSE false END AS is_wishlisted
+			p.rating_average,
+			p.rating_count,
+			p.rating_1_count,
+			p.rating_2_count,
+			p.rating_3_count,
+			p.rating_4_count,
+			p.rating_5_count,
+			p.wishlist_count,
+			p.sales_count,
+			p.rating_count AS reviews_count,
+			CASE WHEN w.product_id IS NOT NULL THEN true ELSE false END AS is_wishlisted,
+			EXISTS (
+				SELECT 1 FROM entitlements e
+				WHERE e.product_id = p.id AND e.user_id = $1 AND (e.expires_at IS NULL OR e.expires_at > NOW())
+			) OR (
+				p.is_bundle AND NOT EXISTS (
+					SELECT 1 FROM bundle_items bi
+					WHERE bi.bundle_id = p.id AND NOT EXISTS (
+						SELECT 1 FROM entitlements e
+						WHERE e.product_id = bi.product_id AND e.user_id = $1 AND (e.expires_at IS NULL OR e.expires_at > NOW())
+					)
+				)
+			) AS is_owned,
+			` + score + ` AS score,
+			` + highlights + `
 		FROM
 			products p
 			INNER JOIN users u ON u.id = p.user_id
-			LEFT JOIN reviews r ON r.product_id = p.id
 			LEFT JOIN user_wishlist w ON w.product_id = p.id AND w.user_id = $1
 		WHERE 1=1
 	`
-	params := []interface{}{userID}
-	paramCount := 1
 
-	// Search Condition
-	if fq.Search != "" {
-		paramCount++
-		query += fmt.Sprintf(" AND (p.name ILIKE '%%' || $%d || '%%' OR p.description ILIKE '%%' || $%d || '%%')", paramCount, paramCount)
-		params = append(params, fq.Search)
-	}
+	// Filter Conditions
+	conditions, params := feedConditions(fq, userID, searchParam, matchParam, params)
+	query += conditions
+	paramCount = len(params)
 
-	// Categories Condition
-	if len(fq.Categories) > 0 {
-		paramCount++
-		query += fmt.Sprintf(" AND p.categories && $%d", paramCount)
-		params = append(params, pq.Array(fq.Categories))
+	// Cursor Condition
+	backward := false
+	if fq.Cursor != nil {
+		after, cursorParams, err := order.after(fq.Cursor, params)
+		if err != nil {
+			return nil, err
+		}
+		query += after
+		params = cursorParams
+		paramCount = len(params)
+		backward = fq.Cursor.Before
 	}
 
-	// Date Range Condition
-	if fq.Since != nil {
-		paramCount++
-		query += fmt.Sprintf(" AND p.created_at >= $%d", paramCount)
-		params = append(params, fq.Since)
-	}
+	// ORDER BY and LIMIT, with one extra row telling whether there is another page
+	paramCount++
+	query += order.orderBy(backward) + fmt.Sprintf(" LIMIT $%d", paramCount)
+	params = append(params, fq.Limit+1)
 
-	if fq.Until != nil {
+	if fq.Cursor == nil {
 		paramCount++
-		query += fmt.Sprintf(" AND p.created_at <= $%d", paramCount)
-		params = append(params, fq.Until)
+		query += fmt.Sprintf(" OFFSET $%d", paramCount)
+		params = append(params, fq.Offset)
 	}
 
-	// GROUP BY Clause
-	query += `
-		GROUP BY 
-			p.id,
-			p.user_id,
-			u.username,
-			p.name,
-			p.price,
-			p.description,
-			p.categories,
-			p.version,
-			p.created_at,
-			w.product_id
-	`
-
-	// ORDER BY and LIMIT
-	paramCount++
-	query += fmt.Sprintf(" ORDER BY p.created_at %s LIMIT $%d", fq.Sort, paramCount)
-	params = append(params, fq.Limit)
-
-	paramCount++
-	query += fmt.Sprintf(" OFFSET $%d", paramCount)
-	params = append(params, fq.Offset)
-
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
@@ -122,26 +440,54 @@ func (s *ProductStore) GetUserFeed(ctx context.Context, userID int64, fq Paginat
 
 	defer rows.Close()
 
-	var feed []UserFeedProduct
+	feed := make([]UserFeedProduct, 0)
 
 	for rows.Next() {
-		var product UserFeedProduct
+		var (
+			product              UserFeedProduct
+			nameHighlight        *string
+			descriptionHighlight *string
+		)
 		if err := rows.Scan(
 			&product.ID,
 			&product.UserID,
 			&product.User.Username,
 			&product.Name,
 			&product.Price,
+			&product.PricingMode,
+			&product.SuggestedPrice,
 			&product.Description,
 			pq.Array(&product.Categories),
+			&product.Type,
+			&product.IsBundle,
 			&product.Version,
 			&product.CreatedAt,
+			&product.Rating.Average,
+			&product.Rating.Count,
+			&product.Rating.Histogram.One,
+			&product.Rating.Histogram.Two,
+			&product.Rating.Histogram.Three,
+			&product.Rating.Histogram.Four,
+			&product.Rating.Histogram.Five,
+			&product.wishlistCount,
+			&product.salesCount,
 			&product.ReviewCount,
 			&product.IsWishlisted,
+			&product.IsOwned,
+			&product.score,
+			&nameHighlight,
+			&descriptionHighlight,
 		); err != nil {
 			return nil, err
 		}
 
+		if nameHighlight != nil && descriptionHighlight != nil {
+			product.Highlights = &SearchHighlights{
+				Name:        *nameHighlight,
+				Description: *descriptionHighlight,
+			}
+		}
+
 		feed = append(feed, product)
 	}
 
@@ -149,44 +495,408 @@ func (s *ProductStore) GetUserFeed(ctx context.Context, userID int64, fq Paginat
 		return nil, err
 	}
 
-	return feed, nil
+	hasPrev := fq.Cursor != nil || fq.Offset > 0
+
+	return newPage(feed, fq.Limit, fq.Cursor, hasPrev, func(p UserFeedProduct) Cursor {
+		if fq.SortBy != "" {
+			return order.cursor(p.CreatedAt, p.ID, p.sortKeys(fq.SortBy)...)
+		}
+
+		switch sort {
+		case SortByRating:
+			return order.cursor(p.CreatedAt, p.ID, p.Rating.Average, float64(p.Rating.Count))
+		case SortRecommended:
+			c := order.cursor(p.CreatedAt, p.ID, p.score)
+			c.At = &rankedAt
+			return c
+		case SortByRelevance:
+			return order.cursor(p.CreatedAt, p.ID, p.score)
+		default:
+			return order.cursor(p.CreatedAt, p.ID)
+		}
+	}), nil
 }
 
-func (s *ProductStore) Create(ctx context.Context, product *Product) error {
+// feedConditions filters products p of sellers u on the query, appending the
+// values to params. The search itself must already be bound to searchParam, or
+// the IDs the search index matched to matchParam when it is set. Following
+// keeps the products of the sellers the user follows.
+func feedConditions(fq PaginationFeedQuery, userID int64, searchParam, matchParam int, params []any) (string, []any) {
+	query := ""
+
+	// Search Condition
+	switch {
+	case matchParam > 0:
+		query += " AND " + fmt.Sprintf(feedIndexMatch, matchParam)
+	case fq.Search != "":
+		query += " AND " + fmt.Sprintf(feedSearchMatch, searchParam)
+	}
+
+	// Categories Condition
+	if len(fq.Categories) > 0 {
+		params = append(params, pq.Array(fq.Categories))
+		query += " AND " + fmt.Sprintf(feedCategoryMatch, len(params))
+	}
+
+	// Date Range Condition
+	if fq.Since != nil {
+		params = append(params, fq.Since)
+		query += fmt.Sprintf(" AND p.created_at >= $%d", len(params))
+	}
+
+	if fq.Until != nil {
+		params = append(params, fq.Until)
+		query += fmt.Sprintf(" AND p.created_at <= $%d", len(params))
+	}
+
+	// Rating Condition
+	if fq.MinRating > 0 {
+		params = append(params, fq.MinRating)
+		query += fmt.Sprintf(" AND p.rating_average >= $%d", len(params))
+	}
 
+	// Price Range Condition
+	if fq.MinPrice > 0 {
+		params = append(params, fq.MinPrice)
+		query += fmt.Sprintf(" AND p.price >= $%d", len(params))
+	}
+
+	if fq.MaxPrice != nil {
+		params = append(params, *fq.MaxPrice)
+		query += fmt.Sprintf(" AND p.price <= $%d", len(params))
+	}
+
+	// Seller Condition
+	if fq.Seller != "" {
+		params = append(params, fq.Seller)
+		query += fmt.Sprintf(" AND u.username = $%d", len(params))
+	}
+
+	// Type Condition
+	if fq.Type != "" {
+		params = append(params, fq.Type)
+		query += fmt.Sprintf(" AND p.type = $%d", len(params))
+	}
+
+	// Following Condition
+	if fq.Following {
+		params = append(params, userID)
+		query += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM seller_follows f WHERE f.follower_id = $%d AND f.seller_id = p.user_id)", len(params))
+	}
+
+	return query, params
+}
+
+// GetSearchFacets counts the products matching the query's filters, as the
+// user sees them, by category, type, seller and price range. Only the most
+// common categories and sellers are counted.
+func (s *ProductStore) GetSearchFacets(ctx context.Context, userID int64, fq PaginationFeedQuery) (*SearchFacets, error) {
+	params := []any{facetLimit, pq.Array(priceRangeBounds)}
+
+	searchParam, matchParam := 0, 0
+	switch {
+	case fq.Search != "" && fq.Matches != nil:
+		params = append(params, pq.Array(fq.Matches.IDs))
+		matchParam = len(params)
+	case fq.Search != "":
+		params = append(params, fq.Search)
+		searchParam = len(params)
+	}
+
+	conditions, params := feedConditions(fq, userID, searchParam, matchParam, params)
+
+	// price ranges are numbered from 1 up, 0 being the free products
 	query := `
-			INSERT INTO products (user_id, name, price, description, categories)
-			VALUES ($1, $2, $3, $4, $5)
-			RETURNING id, created_at, updated_at
-		`
+		WITH matched AS (
+			SELECT p.categories, p.type, p.price, u.username
+			FROM products p
+			JOIN users u ON u.id = p.user_id
+			WHERE 1=1 ` + conditions + `
+		)
+		(
+			SELECT 'category', c.category, COUNT(*)
+			FROM matched, unnest(matched.categories) AS c(category)
+			GROUP BY c.category
+			ORDER BY COUNT(*) DESC, c.category
+			LIMIT $1
+		)
+		UNION ALL
+		(
+			SELECT 'type', type, COUNT(*)
+			FROM matched
+			GROUP BY type
+			ORDER BY COUNT(*) DESC, type
+		)
+		UNION ALL
+		(
+			SELECT 'seller', username, COUNT(*)
+			FROM matched
+			GROUP BY username
+			ORDER BY COUNT(*) DESC, username
+			LIMIT $1
+		)
+		UNION ALL
+		(
+			SELECT 'price', range::text, COUNT(*)
+			FROM (
+				SELECT CASE WHEN price = 0 THEN 0 ELSE width_bucket(price, $2::numeric[]) + 1 END AS range
+				FROM matched
+			) ranges
+			GROUP BY range
+		)
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		product.UserID,
-		product.Name,
-		product.Price,
-		product.Description,
-		pq.Array(product.Categories),
-	).Scan(&product.ID, &product.CreatedAt, &product.UpdatedAt)
+	rows, err := s.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &SearchFacets{
+		Categories:  make([]FacetCount, 0),
+		Types:       make([]FacetCount, 0),
+		Sellers:     make([]FacetCount, 0),
+		PriceRanges: make([]PriceRangeCount, 0),
+	}
+	rangeCounts := make([]int, len(priceRangeBounds)+2)
+
+	for rows.Next() {
+		var (
+			facet string
+			fc    FacetCount
+		)
+		if err := rows.Scan(&facet, &fc.Value, &fc.Count); err != nil {
+			return nil, err
+		}
+
+		switch facet {
+		case "category":
+			facets.Categories = append(facets.Categories, fc)
+		case "type":
+			facets.Types = append(facets.Types, fc)
+		case "seller":
+			facets.Sellers = append(facets.Sellers, fc)
+		case "price":
+			i, err := strconv.Atoi(fc.Value)
+			if err != nil {
+				return nil, err
+			}
+			rangeCounts[i] = fc.Count
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, count := range rangeCounts {
+		if count > 0 {
+			facets.PriceRanges = append(facets.PriceRanges, priceRange(i, count))
+		}
+	}
+
+	return facets, nil
+}
+
+// GetSuggestions returns up to limit product names, categories and sellers
+// starting with the prefix, or close to it for typos. Names starting with it
+// come first. Categories are weighed by popularity as well, the more products
+// they have and the more these were wishlisted, the higher, and match on their
+// slug too.
+func (s *ProductStore) GetSuggestions(ctx context.Context, prefix string, limit int, popularityWeight float64) (*SearchSuggestions, error) {
+	query := `
+		(
+			SELECT 'product', p.id, p.name, '', 0
+			FROM products p
+			WHERE p.name ILIKE $1 OR p.name % $2
+			ORDER BY p.name ILIKE $1 DESC, similarity(p.name, $2) DESC, p.rating_count DESC, p.id
+			LIMIT $3
+		)
+		UNION ALL
+		(
+			SELECT 'category', c.id, c.slug, c.name, COUNT(p.id)
+			FROM categories c
+			LEFT JOIN products p ON p.categories @> ARRAY[c.slug::text]
+			WHERE c.name ILIKE $1 OR c.slug ILIKE $1 OR c.name % $2
+			GROUP BY c.id
+			ORDER BY
+				(CASE WHEN c.name ILIKE $1 OR c.slug ILIKE $1 THEN 1 ELSE similarity(c.name, $2) END)
+				* (1 + $4::float8 * LN(1 + COUNT(p.id) + COALESCE(SUM(p.wishlist_count), 0))) DESC,
+				c.name
+			LIMIT $3
+		)
+		UNION ALL
+		(
+			SELECT 'seller', u.id, u.username, '', 0
+			FROM users u
+			WHERE (u.username ILIKE $1 OR u.username % $2)
+				AND EXISTS (SELECT 1 FROM products p WHERE p.user_id = u.id)
+			ORDER BY u.username ILIKE $1 DESC, similarity(u.username, $2) DESC, u.username
+			LIMIT $3
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
+	rows, err := s.db.QueryContext(ctx, query, likeEscaper.Replace(prefix)+"%", prefix, limit, popularityWeight)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	suggestions := &SearchSuggestions{
+		Products:   make([]ProductSuggestion, 0),
+		Categories: make([]CategorySuggestion, 0),
+		Sellers:    make([]SellerSuggestion, 0),
+	}
+
+	for rows.Next() {
+		var (
+			kind  string
+			id    int64
+			text  string
+			name  string
+			count int
+		)
+		if err := rows.Scan(&kind, &id, &text, &name, &count); err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case "product":
+			suggestions.Products = append(suggestions.Products, ProductSuggestion{ID: id, Name: text})
+		case "category":
+			suggestions.Categories = append(suggestions.Categories, CategorySuggestion{ID: id, Slug: text, Name: name, Count: count})
+		case "seller":
+			suggestions.Sellers = append(suggestions.Sellers, SellerSuggestion{ID: id, Username: text})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// priceRange returns the bounds of the i-th price range: 0 holds the free
+// products, and range i the paid ones priced below priceRangeBounds[i-1].
+func priceRange(i, count int) PriceRangeCount {
+	pr := PriceRangeCount{Count: count}
+
+	if i == 0 {
+		pr.Max = new(float64)
+		return pr
+	}
+
+	if i > 1 {
+		pr.Min = priceRangeBounds[i-2]
+	}
+
+	if i <= len(priceRangeBounds) {
+		bound := priceRangeBounds[i-1]
+		pr.Max = &bound
+	}
+
+	return pr
+}
+
+// Create adds the product, and the followers of its seller get a new product
+// alert.
+func (s *ProductStore) Create(ctx context.Context, product *Product) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO products (user_id, name, price, description, categories, type, pricing_mode, suggested_price)
+			VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'file'), COALESCE(NULLIF($7, ''), 'fixed'), $8)
+			RETURNING id, type, pricing_mode, created_at, updated_at
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			product.UserID,
+			product.Name,
+			product.Price,
+			product.Description,
+			pq.Array(product.Categories),
+			product.Type,
+			product.PricingMode,
+			product.SuggestedPrice,
+		).Scan(&product.ID, &product.Type, &product.PricingMode, &product.CreatedAt, &product.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return queueNewProductAlerts(ctx, tx, product)
+	})
+}
+
+// GetBatch returns up to limit products by ID, starting after afterID, to go
+// through the whole catalogue. Only the products' own details are filled in.
+func (s *ProductStore) GetBatch(ctx context.Context, afterID int64, limit int) ([]Product, error) {
+	query := `
+		SELECT id, user_id, name, price, pricing_mode, description, categories, type, is_bundle, created_at
+		FROM products
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make([]Product, 0, limit)
+	for rows.Next() {
+		var product Product
+		if err := rows.Scan(
+			&product.ID,
+			&product.UserID,
+			&product.Name,
+			&product.Price,
+			&product.PricingMode,
+			&product.Description,
+			pq.Array(&product.Categories),
+			&product.Type,
+			&product.IsBundle,
+			&product.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
 }
 
 func (s *ProductStore) GetByID(ctx context.Context, productID int64) (*Product, error) {
 	query := `
-		SELECT id, user_id, name, price, description, categories, created_at, updated_at, version
+		SELECT
+			id, user_id, name, price, pricing_mode, suggested_price, description, categories, type, is_bundle,
+			created_at, updated_at, version,
+			rating_average, rating_count, rating_1_count, rating_2_count, rating_3_count, rating_4_count, rating_5_count,
+			wishlist_count, sale_price, sale_starts_at, sale_ends_at
 		FROM products
 		WHERE id = $1
 	`
 	var product Product
+	var sale saleColumns
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -196,11 +906,26 @@ func (s *ProductStore) GetByID(ctx context.Context, productID int64) (*Product,
 		&product.UserID,
 		&product.Name,
 		&product.Price,
+		&product.PricingMode,
+		&product.SuggestedPrice,
 		&product.Description,
 		pq.Array(&product.Categories),
+		&product.Type,
+		&product.IsBundle,
 		&product.CreatedAt,
 		&product.UpdatedAt,
 		&product.Version,
+		&product.Rating.Average,
+		&product.Rating.Count,
+		&product.Rating.Histogram.One,
+		&product.Rating.Histogram.Two,
+		&product.Rating.Histogram.Three,
+		&product.Rating.Histogram.Four,
+		&product.Rating.Histogram.Five,
+		&product.WishlistCount,
+		&sale.price,
+		&sale.startsAt,
+		&sale.endsAt,
 	)
 
 	if err != nil {
@@ -212,9 +937,26 @@ func (s *ProductStore) GetByID(ctx context.Context, productID int64) (*Product,
 		}
 	}
 
+	product.Sale = sale.toSale()
+
 	return &product, nil
 }
 
+// saleColumns receives the nullable sale columns of a product.
+type saleColumns struct {
+	price    *float64
+	startsAt *time.Time
+	endsAt   *time.Time
+}
+
+func (c saleColumns) toSale() *ProductSale {
+	if c.price == nil {
+		return nil
+	}
+
+	return &ProductSale{Price: *c.price, StartsAt: *c.startsAt, EndsAt: *c.endsAt}
+}
+
 func (s *ProductStore) Delete(ctx context.Context, productID int64) error {
 	query := `
 		DELETE FROM products WHERE id = $1
@@ -225,7 +967,12 @@ func (s *ProductStore) Delete(ctx context.Context, productID int64) error {
 
 	res, err := s.db.ExecContext(ctx, query, productID)
 	if err != nil {
-		return err
+		switch {
+		case strings.Contains(err.Error(), `"bundle_items_product_id_fkey"`):
+			return ErrInBundle
+		default:
+			return err
+		}
 	}
 
 	rows, err := res.RowsAffected()
@@ -240,40 +987,92 @@ func (s *ProductStore) Delete(ctx context.Context, productID int64) error {
 	return nil
 }
 
+// Update saves the product. When the price goes down, users who wishlisted the
+// product get a price drop alert.
 func (s *ProductStore) Update(ctx context.Context, product *Product) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			WITH old AS (
+				SELECT price FROM products WHERE id = $9 FOR UPDATE
+			)
+			UPDATE products
+			SET name = $1, price = $2, pricing_mode = $3, suggested_price = $4, description = $5, categories = $6, type = $7,
+				updated_at = $8, version = version + 1
+			WHERE id = $9 AND version = $10
+			RETURNING version, (SELECT price FROM old)
+		`
 
-	query := `
-		UPDATE products 
-		SET name = $1, price = $2, description = $3, categories = $4, updated_at = $5, version = version + 1
-		WHERE id = $6 AND version = $7
-		RETURNING version
-	`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
+		var oldPrice float64
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			product.Name,
+			product.Price,
+			product.PricingMode,
+			product.SuggestedPrice,
+			product.Description,
+			pq.Array(product.Categories),
+			product.Type,
+			time.Now().UTC(),
+			product.ID,
+			product.Version,
+		).Scan(&product.Version, &oldPrice)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			// TODO: Refactor this to use PG error codes
+			case strings.Contains(err.Error(), "version"):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		product.Name,
-		product.Price,
-		product.Description,
-		pq.Array(product.Categories),
-		time.Now().UTC(),
-		product.ID,
-		product.Version,
-	).Scan(&product.Version)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		// TODO: Refactor this to use PG error codes
-		case strings.Contains(err.Error(), "version"):
-			return ErrEditConflict
-		default:
-			return err
+		if product.Price < oldPrice {
+			return queuePriceAlerts(ctx, tx, product.ID, PriceAlertKindPriceDrop, oldPrice, product.Price, time.Now().UTC())
 		}
-	}
 
-	return nil
+		return nil
+	})
+}
+
+// UpdateSale starts, reschedules or, with a nil sale, ends the sale of the
+// product. Users who wishlisted it get a sale alert once a new sale starts.
+func (s *ProductStore) UpdateSale(ctx context.Context, product *Product) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE products
+			SET sale_price = $2, sale_starts_at = $3, sale_ends_at = $4, updated_at = NOW(), version = version + 1
+			WHERE id = $1
+			RETURNING version
+		`
+
+		var sale saleColumns
+		if product.Sale != nil {
+			sale = saleColumns{price: &product.Sale.Price, startsAt: &product.Sale.StartsAt, endsAt: &product.Sale.EndsAt}
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, product.ID, sale.price, sale.startsAt, sale.endsAt).Scan(&product.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if product.Sale == nil {
+			return nil
+		}
+
+		return queuePriceAlerts(ctx, tx, product.ID, PriceAlertKindSale, product.Price, product.Sale.Price, product.Sale.StartsAt)
+	})
 }
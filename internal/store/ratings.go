@@ -0,0 +1,18 @@
+package store
+
+// RatingSummary aggregates the reviews of a product. The columns behind it are
+// kept up to date by a trigger on the reviews table.
+type RatingSummary struct {
+	Average   float64         `json:"average"`
+	Count     int             `json:"count"`
+	Histogram RatingHistogram `json:"histogram"`
+}
+
+// RatingHistogram counts the reviews given each number of stars.
+type RatingHistogram struct {
+	One   int `json:"1"`
+	Two   int `json:"2"`
+	Three int `json:"3"`
+	Four  int `json:"4"`
+	Five  int `json:"5"`
+}
@@ -0,0 +1,316 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrRefreshInProgress means another instance is refreshing the same
+// recommendations, so this refresh was skipped.
+var ErrRefreshInProgress = errors.New("recommendations are being refreshed by another instance")
+
+// the advisory locks taken while refreshing each table, so that a single
+// instance refreshes it at a time
+const (
+	trendingRefreshLock int64 = 50001
+	relatedRefreshLock  int64 = 50002
+)
+
+type RelatedKind string
+
+const (
+	RelatedKindBought     RelatedKind = "bought"
+	RelatedKindWishlisted RelatedKind = "wishlisted"
+)
+
+// TrendingRanking weighs the events a product trends on: being wishlisted,
+// reviewed and bought within the window. An event counts half as much every
+// HalfLife that passes.
+type TrendingRanking struct {
+	WishlistWeight float64
+	ReviewWeight   float64
+	PurchaseWeight float64
+	Window         time.Duration
+	HalfLife       time.Duration
+}
+
+// RelatedEvents bounds the purchases and wishlist additions products are
+// related by to those within the window, and to the PerUser products each
+// user bought, or wishlisted, last.
+type RelatedEvents struct {
+	Window  time.Duration
+	PerUser int
+}
+
+// RecommendedProduct is a product with the score it was recommended by.
+type RecommendedProduct struct {
+	Product
+	Score float64 `json:"score"`
+}
+
+// RelatedProducts are the products most often bought, and wishlisted, by the
+// users who bought or wishlisted a product.
+type RelatedProducts struct {
+	AlsoBought     []RecommendedProduct `json:"also_bought"`
+	AlsoWishlisted []RecommendedProduct `json:"also_wishlisted"`
+}
+
+type RecommendationStore struct {
+	db *sql.DB
+}
+
+const selectRecommendedProductQuery = `
+	SELECT
+		p.id, p.user_id, u.username, p.name, p.price, p.pricing_mode, p.suggested_price, p.description,
+		p.categories, p.type, p.is_bundle, p.created_at, p.updated_at, p.version, p.rating_average, p.rating_count,
+		p.sale_price, p.sale_starts_at, p.sale_ends_at
+`
+
+// GetTrending returns the products trending the most, as of the last refresh.
+func (s *RecommendationStore) GetTrending(ctx context.Context, limit int) ([]RecommendedProduct, error) {
+	query := selectRecommendedProductQuery + `, t.score
+		FROM product_trending t
+		JOIN products p ON p.id = t.product_id
+		JOIN users u ON u.id = p.user_id
+		ORDER BY t.score DESC, p.id
+		LIMIT $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make([]RecommendedProduct, 0)
+	for rows.Next() {
+		var product RecommendedProduct
+		if err := scanRecommendedProduct(rows, &product); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// GetRelated returns up to limit products of each kind related to the
+// product, as of the last refresh.
+func (s *RecommendationStore) GetRelated(ctx context.Context, productID int64, limit int) (*RelatedProducts, error) {
+	query := `
+		SELECT related.*, r.kind
+		FROM (VALUES ('bought'), ('wishlisted')) AS r(kind),
+			LATERAL (
+				` + selectRecommendedProductQuery + `, r2.score::float8
+				FROM product_related r2
+				JOIN products p ON p.id = r2.related_id
+				JOIN users u ON u.id = p.user_id
+				WHERE r2.product_id = $1 AND r2.kind = r.kind
+				ORDER BY r2.score DESC, p.id
+				LIMIT $2
+			) related
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, productID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	related := &RelatedProducts{
+		AlsoBought:     make([]RecommendedProduct, 0),
+		AlsoWishlisted: make([]RecommendedProduct, 0),
+	}
+	for rows.Next() {
+		var (
+			kind    RelatedKind
+			product RecommendedProduct
+		)
+		if err := scanRecommendedProduct(rows, &product, &kind); err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case RelatedKindBought:
+			related.AlsoBought = append(related.AlsoBought, product)
+		case RelatedKindWishlisted:
+			related.AlsoWishlisted = append(related.AlsoWishlisted, product)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return related, nil
+}
+
+// RefreshTrending recomputes the limit products trending the most as of now.
+// Being a background job it may take longer than a query, so it is only
+// bounded by the deadline of ctx. ErrRefreshInProgress means another instance
+// was already refreshing them.
+func (s *RecommendationStore) RefreshTrending(ctx context.Context, now time.Time, ranking TrendingRanking, limit int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := tryRefreshLock(ctx, tx, trendingRefreshLock); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM product_trending`); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO product_trending (product_id, score, computed_at)
+			SELECT e.product_id, SUM(e.weight * EXP(GREATEST(-LN(2) * EXTRACT(EPOCH FROM ($1::timestamptz - e.at)) / $3::float8, -700))) AS score, $1
+			FROM (
+				SELECT w.product_id, w.created_at AS at, $4::float8 AS weight
+				FROM user_wishlist w
+				WHERE w.created_at > $2
+				UNION ALL
+				SELECT r.product_id, r.created_at, $5::float8
+				FROM reviews r
+				WHERE r.status = 'approved' AND r.created_at > $2
+				UNION ALL
+				SELECT oi.product_id, o.updated_at, $6::float8 * oi.quantity
+				FROM order_items oi
+				JOIN orders o ON o.id = oi.order_id
+				WHERE o.status = 'paid' AND oi.product_id IS NOT NULL AND o.updated_at > $2
+			) e
+			GROUP BY e.product_id
+			ORDER BY score DESC
+			LIMIT $7
+		`
+
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			now,
+			now.Add(-ranking.Window),
+			ranking.HalfLife.Seconds(),
+			ranking.WishlistWeight,
+			ranking.ReviewWeight,
+			ranking.PurchaseWeight,
+			limit,
+		)
+
+		return err
+	})
+}
+
+// RefreshRelated recomputes, for every product, the limit products of each
+// kind most often bought or wishlisted together with it by the same users,
+// out of the events as of now. Like RefreshTrending it is only bounded by the
+// deadline of ctx.
+func (s *RecommendationStore) RefreshRelated(ctx context.Context, now time.Time, events RelatedEvents, limit int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := tryRefreshLock(ctx, tx, relatedRefreshLock); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM product_related`); err != nil {
+			return err
+		}
+
+		query := `
+			WITH events AS (
+				SELECT kind, user_id, product_id
+				FROM (
+					SELECT e.kind, e.user_id, e.product_id,
+						row_number() OVER (PARTITION BY e.kind, e.user_id ORDER BY e.at DESC, e.product_id) AS recency
+					FROM (
+						SELECT 'bought' AS kind, o.user_id, oi.product_id, MAX(o.updated_at) AS at
+						FROM orders o
+						JOIN order_items oi ON oi.order_id = o.id
+						WHERE o.status = 'paid' AND oi.product_id IS NOT NULL AND o.updated_at > $1
+						GROUP BY o.user_id, oi.product_id
+						UNION ALL
+						SELECT 'wishlisted', w.user_id, w.product_id, w.created_at
+						FROM user_wishlist w
+						WHERE w.created_at > $1
+					) e
+				) recent
+				WHERE recency <= $2
+			)
+			INSERT INTO product_related (product_id, related_id, kind, score)
+			SELECT product_id, related_id, kind, score
+			FROM (
+				SELECT a.product_id, b.product_id AS related_id, a.kind, COUNT(*) AS score,
+					row_number() OVER (PARTITION BY a.product_id, a.kind ORDER BY COUNT(*) DESC, b.product_id) AS position
+				FROM events a
+				JOIN events b ON b.kind = a.kind AND b.user_id = a.user_id AND b.product_id <> a.product_id
+				GROUP BY a.product_id, b.product_id, a.kind
+			) pairs
+			WHERE position <= $3
+		`
+
+		_, err := tx.ExecContext(ctx, query, now.Add(-events.Window), events.PerUser, limit)
+
+		return err
+	})
+}
+
+// tryRefreshLock takes the advisory lock until tx ends, or returns
+// ErrRefreshInProgress if another transaction holds it.
+func tryRefreshLock(ctx context.Context, tx *sql.Tx, lock int64) error {
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, lock).Scan(&locked); err != nil {
+		return err
+	}
+
+	if !locked {
+		return ErrRefreshInProgress
+	}
+
+	return nil
+}
+
+// scanRecommendedProduct scans the product, then any extra columns selected
+// after it into extra.
+func scanRecommendedProduct(row interface{ Scan(...any) error }, product *RecommendedProduct, extra ...any) error {
+	var sale saleColumns
+
+	dest := []any{
+		&product.ID,
+		&product.UserID,
+		&product.User.Username,
+		&product.Name,
+		&product.Price,
+		&product.PricingMode,
+		&product.SuggestedPrice,
+		&product.Description,
+		pq.Array(&product.Categories),
+		&product.Type,
+		&product.IsBundle,
+		&product.CreatedAt,
+		&product.UpdatedAt,
+		&product.Version,
+		&product.Rating.Average,
+		&product.Rating.Count,
+		&sale.price,
+		&sale.startsAt,
+		&sale.endsAt,
+		&product.Score,
+	}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	product.Sale = sale.toSale()
+
+	return nil
+}
@@ -3,37 +3,189 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 )
 
+// ReviewStatus tells whether a review is published. Reviews the moderation
+// filter holds stay pending until a moderator approves or rejects them, and
+// moderators can hide approved reviews later on.
+type ReviewStatus string
+
+const (
+	ReviewStatusPending  ReviewStatus = "pending"
+	ReviewStatusApproved ReviewStatus = "approved"
+	ReviewStatusRejected ReviewStatus = "rejected"
+	ReviewStatusHidden   ReviewStatus = "hidden"
+)
+
 type Review struct {
+	ID               int64           `json:"id"`
+	UserID           int64           `json:"user_id"`
+	ProductID        int64           `json:"product_id"`
+	Rating           int             `json:"rating"`
+	Comment          string          `json:"comment"`
+	VerifiedPurchase bool            `json:"verified_purchase"`
+	HelpfulCount     int             `json:"helpful_count"`
+	Status           ReviewStatus    `json:"status"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	User             User            `json:"user"`
+	Response         *ReviewResponse `json:"response,omitempty"`
+}
+
+type ReviewStore struct {
+	DB *sql.DB
+}
+
+// verifiedPurchaseQuery tells whether user $1 bought product $2 for themselves,
+// on its own or as part of a bundle.
+const verifiedPurchaseQuery = `
+	EXISTS (
+		SELECT 1
+		FROM orders o
+		JOIN order_items oi ON oi.order_id = o.id
+		LEFT JOIN bundle_items bi ON bi.bundle_id = oi.product_id
+		WHERE o.user_id = $1
+			AND o.status = 'paid'
+			AND (oi.product_id = $2 OR bi.product_id = $2)
+			AND NOT EXISTS (SELECT 1 FROM gifts g WHERE g.order_id = o.id)
+	)
+`
+
+// ReviewResponse is the seller's public reply to a review.
+type ReviewResponse struct {
 	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	ProductID int64     `json:"product_id"`
-	Rating    int       `json:"rating"`
-	Comment   string    `json:"comment"`
+	ReviewID  int64     `json:"review_id"`
+	SellerID  int64     `json:"seller_id"`
+	Body      string    `json:"body"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
-	User      User      `json:"user"`
 }
 
-type ReviewStore struct {
-	DB *sql.DB
+const selectReviewQuery = `
+	SELECT
+		r.id, r.user_id, r.product_id, r.rating, r.comment, r.verified_purchase, r.helpful_count, r.status,
+		r.created_at, r.updated_at, users.username, users.id,
+		rr.id, rr.seller_id, rr.body, rr.created_at, rr.updated_at
+	FROM reviews r
+	JOIN users on users.id = r.user_id
+	LEFT JOIN review_responses rr ON rr.review_id = r.id
+`
+
+func scanReview(row interface{ Scan(...any) error }, review *Review) error {
+	var (
+		responseID        *int64
+		responseSellerID  *int64
+		responseBody      *string
+		responseCreatedAt *time.Time
+		responseUpdatedAt *time.Time
+	)
+
+	err := row.Scan(
+		&review.ID,
+		&review.UserID,
+		&review.ProductID,
+		&review.Rating,
+		&review.Comment,
+		&review.VerifiedPurchase,
+		&review.HelpfulCount,
+		&review.Status,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.User.Username,
+		&review.User.ID,
+		&responseID,
+		&responseSellerID,
+		&responseBody,
+		&responseCreatedAt,
+		&responseUpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if responseID != nil {
+		review.Response = &ReviewResponse{
+			ID:        *responseID,
+			ReviewID:  review.ID,
+			SellerID:  *responseSellerID,
+			Body:      *responseBody,
+			CreatedAt: *responseCreatedAt,
+			UpdatedAt: *responseUpdatedAt,
+		}
+	}
+
+	return nil
 }
 
-func (s *ReviewStore) GetByProductID(ctx context.Context, productID int64) ([]Review, error) {
+// reviewOrders maps each sort to the keyset ordering the reviews and to the
+// values of its sort keys for a review.
+var reviewOrders = map[string]struct {
+	keyset keyset
+	keys   func(*Review) []float64
+}{
+	ReviewSortNewest: {
+		keyset: keyset{sort: "reviews:" + ReviewSortNewest, columns: []keysetColumn{
+			{"r.created_at", true}, {"r.id", true},
+		}},
+		keys: func(*Review) []float64 { return nil },
+	},
+	ReviewSortHighest: {
+		keyset: keyset{sort: "reviews:" + ReviewSortHighest, columns: []keysetColumn{
+			{"r.rating", true}, {"r.created_at", true}, {"r.id", true},
+		}},
+		keys: func(r *Review) []float64 { return []float64{float64(r.Rating)} },
+	},
+	ReviewSortLowest: {
+		keyset: keyset{sort: "reviews:" + ReviewSortLowest, columns: []keysetColumn{
+			{"r.rating", false}, {"r.created_at", true}, {"r.id", true},
+		}},
+		keys: func(r *Review) []float64 { return []float64{float64(r.Rating)} },
+	},
+	ReviewSortHelpful: {
+		keyset: keyset{sort: "reviews:" + ReviewSortHelpful, columns: []keysetColumn{
+			{"r.helpful_count", true}, {"r.created_at", true}, {"r.id", true},
+		}},
+		keys: func(r *Review) []float64 { return []float64{float64(r.HelpfulCount)} },
+	},
+}
 
-	query := `
-		SELECT r.id, r.user_id, r.product_id, r.rating, r.comment, r.created_at, users.username, users.id FROM reviews r
-		JOIN users on users.id = r.user_id
+// GetByProductID returns a page of the product's reviews around the query's
+// cursor.
+func (s *ReviewStore) GetByProductID(ctx context.Context, productID int64, rq ReviewQuery) (*Page[Review], error) {
+	order, ok := reviewOrders[rq.Sort]
+	if !ok {
+		order = reviewOrders[ReviewSortNewest]
+	}
+
+	// one extra row tells whether there is another page
+	args := []any{productID, rq.Rating, rq.VerifiedOnly, rq.Limit + 1}
+
+	after := ""
+	backward := false
+	if rq.Cursor != nil {
+		var err error
+		after, args, err = order.keyset.after(rq.Cursor, args)
+		if err != nil {
+			return nil, err
+		}
+		backward = rq.Cursor.Before
+	}
+
+	query := selectReviewQuery + `
 		WHERE r.product_id = $1
-		ORDER BY r.created_at DESC;
+			AND r.status = 'approved'
+			AND ($2 = 0 OR r.rating = $2)
+			AND (NOT $3 OR r.verified_purchase)
+			` + after + order.keyset.orderBy(backward) + `
+		LIMIT $4;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.DB.QueryContext(ctx, query, productID)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -42,44 +194,243 @@ func (s *ReviewStore) GetByProductID(ctx context.Context, productID int64) ([]Re
 	reviews := make([]Review, 0)
 	for rows.Next() {
 		var r Review
-		r.User = User{}
-		err := rows.Scan(
-			&r.ID,
-			&r.UserID,
-			&r.ProductID,
-			&r.Rating,
-			&r.Comment,
-			&r.CreatedAt,
-			&r.User.Username,
-			&r.User.ID,
-		)
-		if err != nil {
+		if err := scanReview(rows, &r); err != nil {
 			return nil, err
 		}
 		reviews = append(reviews, r)
 	}
-	return reviews, nil
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newPage(reviews, rq.Limit, rq.Cursor, rq.Cursor != nil, func(r Review) Cursor {
+		return order.keyset.cursor(r.CreatedAt, r.ID, order.keys(&r)...)
+	}), nil
+}
+
+func (s *ReviewStore) GetByID(ctx context.Context, reviewID int64) (*Review, error) {
+	query := selectReviewQuery + `
+		WHERE r.id = $1
+	`
+
+	return s.getOne(ctx, query, reviewID)
+}
+
+func (s *ReviewStore) GetByUserAndProduct(ctx context.Context, userID, productID int64) (*Review, error) {
+	query := selectReviewQuery + `
+		WHERE r.user_id = $1 AND r.product_id = $2
+	`
+
+	return s.getOne(ctx, query, userID, productID)
+}
+
+func (s *ReviewStore) getOne(ctx context.Context, query string, args ...any) (*Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var review Review
+	err := scanReview(s.DB.QueryRowContext(ctx, query, args...), &review)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
 }
 
+// Create stores the review, flagging it as a verified purchase when the user
+// bought the product. A user can only review a product once.
 func (s *ReviewStore) Create(ctx context.Context, review *Review) error {
 	query := `
-		INSERT INTO reviews (user_id, product_id, rating, comment)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at
+		INSERT INTO reviews (user_id, product_id, rating, comment, status, verified_purchase)
+		VALUES ($1, $2, $3, $4, $5, ` + verifiedPurchaseQuery + `)
+		RETURNING id, verified_purchase, created_at, updated_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	return s.DB.QueryRowContext(
+	err := s.DB.QueryRowContext(
 		ctx,
 		query,
 		review.UserID,
 		review.ProductID,
 		review.Rating,
 		review.Comment,
+		review.Status,
 	).Scan(
 		&review.ID,
+		&review.VerifiedPurchase,
 		&review.CreatedAt,
+		&review.UpdatedAt,
 	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_user_product_key"`:
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update changes the rating, comment and status. The verified purchase flag is worked
+// out again, as the reviewer may have bought the product since.
+func (s *ReviewStore) Update(ctx context.Context, review *Review) error {
+	query := `
+		UPDATE reviews
+		SET rating = $3, comment = $4, status = $6, verified_purchase = ` + verifiedPurchaseQuery + `, updated_at = NOW()
+		WHERE user_id = $1 AND product_id = $2 AND id = $5
+		RETURNING verified_purchase, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(
+		ctx,
+		query,
+		review.UserID,
+		review.ProductID,
+		review.Rating,
+		review.Comment,
+		review.ID,
+		review.Status,
+	).Scan(&review.VerifiedPurchase, &review.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ReviewStore) Delete(ctx context.Context, reviewID int64) error {
+	query := `DELETE FROM reviews WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, query, reviewID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Vote marks the review as helpful for the user. A user can only vote once on
+// a review.
+func (s *ReviewStore) Vote(ctx context.Context, reviewID, userID int64) error {
+	query := `INSERT INTO review_votes (review_id, user_id) VALUES ($1, $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, query, reviewID, userID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "review_votes_pkey"`:
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ReviewStore) Unvote(ctx context.Context, reviewID, userID int64) error {
+	query := `DELETE FROM review_votes WHERE review_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, query, reviewID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SaveResponse creates the seller's response to a review, or replaces the
+// existing one. It reports whether the response is new.
+func (s *ReviewStore) SaveResponse(ctx context.Context, response *ReviewResponse) (bool, error) {
+	query := `
+		INSERT INTO review_responses (review_id, seller_id, body)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (review_id) DO UPDATE
+		SET seller_id = EXCLUDED.seller_id, body = EXCLUDED.body, updated_at = NOW()
+		RETURNING id, created_at, updated_at, (xmax = 0) AS created
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var created bool
+	err := s.DB.QueryRowContext(
+		ctx,
+		query,
+		response.ReviewID,
+		response.SellerID,
+		response.Body,
+	).Scan(&response.ID, &response.CreatedAt, &response.UpdatedAt, &created)
+	if err != nil {
+		return false, err
+	}
+
+	return created, nil
+}
+
+func (s *ReviewStore) DeleteResponse(ctx context.Context, reviewID int64) error {
+	query := `DELETE FROM review_responses WHERE review_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, query, reviewID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
 }
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Seller is the public profile of a user selling on the marketplace. Its
+// rating averages the reviews of all of the seller's products, and IsFollowed
+// tells whether the user viewing it follows the seller.
+type Seller struct {
+	ID            int64        `json:"id"`
+	Username      string       `json:"username"`
+	Storefront    Storefront   `json:"storefront"`
+	ProductCount  int          `json:"product_count"`
+	FollowerCount int          `json:"follower_count"`
+	IsFollowed    bool         `json:"is_followed"`
+	Rating        SellerRating `json:"rating"`
+	JoinedAt      time.Time    `json:"joined_at"`
+}
+
+type SellerRating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// Storefront is how a seller presents themselves. Every user has one, its
+// unique slug first taken from their username.
+type Storefront struct {
+	UserID    int64     `json:"user_id"`
+	Slug      string    `json:"slug"`
+	BannerURL string    `json:"banner_url"`
+	About     string    `json:"about"`
+	Links     []string  `json:"links"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SellerStore struct {
+	db *sql.DB
+}
+
+// GetBySlug returns the active seller with the storefront slug, as seen by the
+// viewer, or by an anonymous visitor when viewerID is 0.
+func (s *SellerStore) GetBySlug(ctx context.Context, slug string, viewerID int64) (*Seller, error) {
+	query := `
+		SELECT
+			u.id, u.username, u.created_at,
+			sf.user_id, sf.slug, sf.banner_url, sf.about, sf.links, sf.updated_at,
+			COUNT(p.id),
+			(SELECT COUNT(*) FROM seller_follows f WHERE f.seller_id = u.id),
+			EXISTS (SELECT 1 FROM seller_follows f WHERE f.seller_id = u.id AND f.follower_id = $2),
+			COALESCE(SUM(p.rating_average * p.rating_count) / NULLIF(SUM(p.rating_count), 0), 0),
+			COALESCE(SUM(p.rating_count), 0)
+		FROM storefronts sf
+		JOIN users u ON u.id = sf.user_id
+		LEFT JOIN products p ON p.user_id = u.id
+		WHERE sf.slug = $1 AND u.is_active
+		GROUP BY u.id, sf.user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var seller Seller
+	err := s.db.QueryRowContext(ctx, query, slug, viewerID).Scan(
+		&seller.ID,
+		&seller.Username,
+		&seller.JoinedAt,
+		&seller.Storefront.UserID,
+		&seller.Storefront.Slug,
+		&seller.Storefront.BannerURL,
+		&seller.Storefront.About,
+		pq.Array(&seller.Storefront.Links),
+		&seller.Storefront.UpdatedAt,
+		&seller.ProductCount,
+		&seller.FollowerCount,
+		&seller.IsFollowed,
+		&seller.Rating.Average,
+		&seller.Rating.Count,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &seller, nil
+}
+
+func (s *SellerStore) GetStorefront(ctx context.Context, userID int64) (*Storefront, error) {
+	query := `
+		SELECT user_id, slug, banner_url, about, links, updated_at
+		FROM storefronts
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var storefront Storefront
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&storefront.UserID,
+		&storefront.Slug,
+		&storefront.BannerURL,
+		&storefront.About,
+		pq.Array(&storefront.Links),
+		&storefront.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &storefront, nil
+}
+
+// UpdateStorefront saves the storefront. ErrConflict means another seller has
+// its slug.
+func (s *SellerStore) UpdateStorefront(ctx context.Context, storefront *Storefront) error {
+	query := `
+		UPDATE storefronts
+		SET slug = $1, banner_url = $2, about = $3, links = $4, updated_at = NOW()
+		WHERE user_id = $5
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		storefront.Slug,
+		storefront.BannerURL,
+		storefront.About,
+		pq.Array(storefront.Links),
+		storefront.UserID,
+	).Scan(&storefront.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		case err.Error() == `pq: duplicate key value violates unique constraint "storefronts_slug_key"`:
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Follow makes the user a follower of the seller, if they weren't already.
+func (s *SellerStore) Follow(ctx context.Context, followerID, sellerID int64) error {
+	query := `
+		INSERT INTO seller_follows (follower_id, seller_id)
+		VALUES ($1, $2)
+		ON CONFLICT (follower_id, seller_id) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, followerID, sellerID)
+
+	return err
+}
+
+func (s *SellerStore) Unfollow(ctx context.Context, followerID, sellerID int64) error {
+	query := `DELETE FROM seller_follows WHERE follower_id = $1 AND seller_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, followerID, sellerID)
+
+	return err
+}
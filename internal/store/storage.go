@@ -14,15 +14,21 @@ var (
 	QueryTimeoutDuration = 5 * time.Second
 	ErrDuplicateEmail    = errors.New("duplicate email")
 	ErrDuplicateUsername = errors.New("duplicate username")
+	ErrInBundle          = errors.New("product is part of a bundle")
+	ErrInvalidCursor     = errors.New("invalid cursor")
 )
 
 type Storage struct {
 	Products interface {
 		GetByID(context.Context, int64) (*Product, error)
+		GetBatch(ctx context.Context, afterID int64, limit int) ([]Product, error)
 		Create(context.Context, *Product) error
 		Delete(context.Context, int64) error
 		Update(context.Context, *Product) error
-		GetUserFeed(context.Context, int64, PaginationFeedQuery) ([]UserFeedProduct, error)
+		UpdateSale(context.Context, *Product) error
+		GetUserFeed(context.Context, int64, PaginationFeedQuery, FeedRanking) (*Page[UserFeedProduct], error)
+		GetSearchFacets(context.Context, int64, PaginationFeedQuery) (*SearchFacets, error)
+		GetSuggestions(ctx context.Context, prefix string, limit int, popularityWeight float64) (*SearchSuggestions, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
@@ -33,25 +39,140 @@ type Storage struct {
 		GetByEmail(context.Context, string) (*User, error)
 	}
 	Reviews interface {
-		GetByProductID(context.Context, int64) ([]Review, error)
+		GetByProductID(ctx context.Context, productID int64, rq ReviewQuery) (*Page[Review], error)
+		GetByID(context.Context, int64) (*Review, error)
+		GetByUserAndProduct(ctx context.Context, userID, productID int64) (*Review, error)
 		Create(context.Context, *Review) error
+		Update(context.Context, *Review) error
+		Delete(context.Context, int64) error
+		Vote(ctx context.Context, reviewID, userID int64) error
+		Unvote(ctx context.Context, reviewID, userID int64) error
+		SaveResponse(context.Context, *ReviewResponse) (bool, error)
+		DeleteResponse(context.Context, int64) error
 	}
 	Wishlist interface {
 		Add(ctx context.Context, userID, productID int64) error
 		Remove(ctx context.Context, userID, productID int64) error
+		GetByUserID(context.Context, int64, PaginationFeedQuery) (*Page[WishlistItem], error)
+		GetCollections(context.Context, int64) ([]WishlistCollection, error)
+		GetCollectionByID(context.Context, int64) (*WishlistCollection, error)
+		GetCollectionBySlug(context.Context, string) (*WishlistCollection, error)
+		CreateCollection(context.Context, *WishlistCollection) error
+		UpdateCollection(context.Context, *WishlistCollection) error
+		DeleteCollection(context.Context, int64) error
+		GetCollectionItems(context.Context, int64, PaginationFeedQuery) (*Page[WishlistItem], error)
+		AddToCollection(ctx context.Context, collection *WishlistCollection, productID int64) error
+		RemoveFromCollection(ctx context.Context, collectionID, productID int64) error
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	Entitlements interface {
+		Grant(context.Context, *Entitlement) error
+		Revoke(ctx context.Context, userID, productID int64) error
+		IsOwned(ctx context.Context, userID, productID int64) (bool, error)
+		GetLibrary(context.Context, int64, PaginationFeedQuery) ([]Entitlement, error)
+	}
+	Subscriptions interface {
+		CreatePlan(context.Context, *SubscriptionPlan) error
+		GetPlanByID(context.Context, int64) (*SubscriptionPlan, error)
+		GetPlansByProductID(context.Context, int64) ([]SubscriptionPlan, error)
+		Create(context.Context, *Subscription) error
+		GetByID(context.Context, int64) (*Subscription, error)
+		GetByUserID(context.Context, int64) ([]Subscription, error)
+		GetDue(ctx context.Context, now time.Time, limit int) ([]Subscription, error)
+		ProcessDue(ctx context.Context, subscriptionID int64, now time.Time, process func(*Subscription)) (*Subscription, error)
+		Update(context.Context, *Subscription) error
+	}
+	Orders interface {
+		Create(context.Context, *Order) error
+		Complete(ctx context.Context, order *Order, paymentReference string) error
+		MarkFailed(context.Context, *Order) error
+		MarkNotCompleted(ctx context.Context, order *Order, status OrderStatus, paymentReference string) error
+		GetByID(context.Context, int64) (*Order, error)
+		GetByUserID(context.Context, int64) ([]Order, error)
+	}
+	TaxRules interface {
+		FindRule(ctx context.Context, country, productType string, at time.Time) (*TaxRule, error)
+		GetByID(context.Context, int64) (*TaxRule, error)
+		List(ctx context.Context, country string) ([]TaxRule, error)
+		Create(context.Context, *TaxRule) error
+		Update(context.Context, *TaxRule) error
+		Delete(context.Context, int64) error
+	}
+	Categories interface {
+		GetByID(context.Context, int64) (*Category, error)
+		GetTree(context.Context) ([]*Category, error)
+		GetUnknownSlugs(ctx context.Context, slugs []string) ([]string, error)
+		Create(context.Context, *Category) error
+		Update(context.Context, *Category) ([]int64, error)
+		Delete(context.Context, int64) error
+	}
+	Gifts interface {
+		GetByID(context.Context, int64) (*Gift, error)
+		GetByToken(context.Context, string) (*Gift, error)
+		GetByPurchaserID(context.Context, int64) ([]Gift, error)
+		Redeem(ctx context.Context, gift *Gift, recipientID int64) error
+	}
+	Bundles interface {
+		Create(ctx context.Context, bundle *Product, productIDs []int64) error
+		GetProducts(ctx context.Context, bundleID int64) ([]Product, error)
+		GetByProductID(ctx context.Context, productID int64) ([]Product, error)
+	}
+	Sellers interface {
+		GetBySlug(ctx context.Context, slug string, viewerID int64) (*Seller, error)
+		Follow(ctx context.Context, followerID, sellerID int64) error
+		Unfollow(ctx context.Context, followerID, sellerID int64) error
+		GetStorefront(context.Context, int64) (*Storefront, error)
+		UpdateStorefront(context.Context, *Storefront) error
+	}
+	Recommendations interface {
+		GetTrending(ctx context.Context, limit int) ([]RecommendedProduct, error)
+		GetRelated(ctx context.Context, productID int64, limit int) (*RelatedProducts, error)
+		RefreshTrending(ctx context.Context, now time.Time, ranking TrendingRanking, limit int) error
+		RefreshRelated(ctx context.Context, now time.Time, events RelatedEvents, limit int) error
+	}
+	BillingAddresses interface {
+		GetByUserID(context.Context, int64) (*BillingAddress, error)
+		Upsert(context.Context, *BillingAddress) error
+	}
+	Notifications interface {
+		GetPreferences(context.Context, int64) (*NotificationPreferences, error)
+		UpdatePreferences(context.Context, *NotificationPreferences) error
+		Unsubscribe(ctx context.Context, token string) error
+		GetDueDigests(ctx context.Context, now, lastDigestBefore time.Time, limit int) ([]Digest, error)
+		ProcessDigest(ctx context.Context, digest *Digest, now, lastDigestBefore time.Time, send func(*Digest) error) error
+	}
+	Moderation interface {
+		CreateReport(context.Context, *Report) error
+		GetReportByID(context.Context, int64) (*Report, error)
+		GetReports(ctx context.Context, status ReportStatus, fq PaginationFeedQuery) ([]Report, error)
+		GetQueue(context.Context, PaginationFeedQuery) ([]QueuedReview, error)
+		ModerateReview(ctx context.Context, reviewID, moderatorID int64, status ReviewStatus, note string) error
+		ResolveReport(ctx context.Context, report *Report, moderatorID int64, status ReportStatus, note string) error
+		GetActions(context.Context, PaginationFeedQuery) ([]ModerationAction, error)
+	}
 }
 
 func New(db *sql.DB) *Storage {
 	return &Storage{
-		Products: &ProductStore{db},
-		Users:    &UserStore{db},
-		Reviews:  &ReviewStore{db},
-		Wishlist: &WishlistStore{db},
-		Roles:    &RoleStore{db},
+		Products:         &ProductStore{db},
+		Users:            &UserStore{db},
+		Reviews:          &ReviewStore{db},
+		Wishlist:         &WishlistStore{db},
+		Roles:            &RoleStore{db},
+		Entitlements:     &EntitlementStore{db},
+		Subscriptions:    &SubscriptionStore{db},
+		Orders:           &OrderStore{db},
+		TaxRules:         &TaxRuleStore{db},
+		Categories:       &CategoryStore{db},
+		Gifts:            &GiftStore{db},
+		Bundles:          &BundleStore{db},
+		Sellers:          &SellerStore{db},
+		Recommendations:  &RecommendationStore{db},
+		BillingAddresses: &BillingAddressStore{db},
+		Moderation:       &ModerationStore{db},
+		Notifications:    &NotificationStore{db},
 	}
 }
 
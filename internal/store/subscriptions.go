@@ -0,0 +1,418 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type BillingInterval string
+
+const (
+	BillingIntervalDay   BillingInterval = "day"
+	BillingIntervalWeek  BillingInterval = "week"
+	BillingIntervalMonth BillingInterval = "month"
+	BillingIntervalYear  BillingInterval = "year"
+)
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusTrialing SubscriptionStatus = "trialing"
+	SubscriptionStatusActive   SubscriptionStatus = "active"
+	SubscriptionStatusPastDue  SubscriptionStatus = "past_due"
+	SubscriptionStatusCanceled SubscriptionStatus = "canceled"
+	SubscriptionStatusExpired  SubscriptionStatus = "expired"
+)
+
+type SubscriptionPlan struct {
+	ID            int64           `json:"id"`
+	ProductID     int64           `json:"product_id"`
+	Name          string          `json:"name"`
+	Price         float64         `json:"price"`
+	Interval      BillingInterval `json:"interval"`
+	IntervalCount int             `json:"interval_count"`
+	TrialDays     int             `json:"trial_days"`
+	Active        bool            `json:"active"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// NextPeriodEnd returns the end of the billing period starting at start.
+func (p *SubscriptionPlan) NextPeriodEnd(start time.Time) time.Time {
+	switch p.Interval {
+	case BillingIntervalDay:
+		return start.AddDate(0, 0, p.IntervalCount)
+	case BillingIntervalWeek:
+		return start.AddDate(0, 0, 7*p.IntervalCount)
+	case BillingIntervalYear:
+		return start.AddDate(p.IntervalCount, 0, 0)
+	default:
+		return start.AddDate(0, p.IntervalCount, 0)
+	}
+}
+
+type Subscription struct {
+	ID                 int64              `json:"id"`
+	UserID             int64              `json:"user_id"`
+	PlanID             int64              `json:"plan_id"`
+	Status             SubscriptionStatus `json:"status"`
+	CurrentPeriodStart time.Time          `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time          `json:"current_period_end"`
+	TrialEndsAt        *time.Time         `json:"trial_ends_at,omitempty"`
+	GraceUntil         *time.Time         `json:"grace_until,omitempty"`
+	CanceledAt         *time.Time         `json:"canceled_at,omitempty"`
+	NextAttemptAt      time.Time          `json:"next_attempt_at"`
+	FailedAttempts     int                `json:"failed_attempts"`
+	PaymentReference   string             `json:"-"`
+	CreatedAt          time.Time          `json:"created_at"`
+	UpdatedAt          time.Time          `json:"updated_at"`
+	Version            int                `json:"version"`
+	Plan               SubscriptionPlan   `json:"plan"`
+}
+
+// AccessUntil reports when the entitlement granted by the subscription lapses.
+func (s *Subscription) AccessUntil() time.Time {
+	switch s.Status {
+	case SubscriptionStatusPastDue:
+		if s.GraceUntil != nil {
+			return *s.GraceUntil
+		}
+		return s.CurrentPeriodEnd
+	case SubscriptionStatusExpired:
+		return time.Now().UTC()
+	default:
+		return s.CurrentPeriodEnd
+	}
+}
+
+type SubscriptionStore struct {
+	db *sql.DB
+}
+
+func (s *SubscriptionStore) CreatePlan(ctx context.Context, plan *SubscriptionPlan) error {
+	query := `
+		INSERT INTO subscription_plans (product_id, name, price, billing_interval, interval_count, trial_days)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, active, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		plan.ProductID,
+		plan.Name,
+		plan.Price,
+		plan.Interval,
+		plan.IntervalCount,
+		plan.TrialDays,
+	).Scan(&plan.ID, &plan.Active, &plan.CreatedAt, &plan.UpdatedAt)
+}
+
+func (s *SubscriptionStore) GetPlanByID(ctx context.Context, planID int64) (*SubscriptionPlan, error) {
+	query := `
+		SELECT id, product_id, name, price, billing_interval, interval_count, trial_days, active, created_at, updated_at
+		FROM subscription_plans
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var plan SubscriptionPlan
+	err := s.db.QueryRowContext(ctx, query, planID).Scan(
+		&plan.ID,
+		&plan.ProductID,
+		&plan.Name,
+		&plan.Price,
+		&plan.Interval,
+		&plan.IntervalCount,
+		&plan.TrialDays,
+		&plan.Active,
+		&plan.CreatedAt,
+		&plan.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &plan, nil
+}
+
+func (s *SubscriptionStore) GetPlansByProductID(ctx context.Context, productID int64) ([]SubscriptionPlan, error) {
+	query := `
+		SELECT id, product_id, name, price, billing_interval, interval_count, trial_days, active, created_at, updated_at
+		FROM subscription_plans
+		WHERE product_id = $1 AND active = true
+		ORDER BY price ASC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := make([]SubscriptionPlan, 0)
+	for rows.Next() {
+		var plan SubscriptionPlan
+		if err := rows.Scan(
+			&plan.ID,
+			&plan.ProductID,
+			&plan.Name,
+			&plan.Price,
+			&plan.Interval,
+			&plan.IntervalCount,
+			&plan.TrialDays,
+			&plan.Active,
+			&plan.CreatedAt,
+			&plan.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+// Create stores a new subscription and grants the entitlement to the plan's
+// product for as long as the subscription gives access.
+func (s *SubscriptionStore) Create(ctx context.Context, sub *Subscription) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO subscriptions (
+				user_id, plan_id, status, current_period_start, current_period_end,
+				trial_ends_at, next_attempt_at, payment_reference
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, created_at, updated_at, version
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			sub.UserID,
+			sub.PlanID,
+			sub.Status,
+			sub.CurrentPeriodStart,
+			sub.CurrentPeriodEnd,
+			sub.TrialEndsAt,
+			sub.NextAttemptAt,
+			sub.PaymentReference,
+		).Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt, &sub.Version)
+		if err != nil {
+			return err
+		}
+
+		return syncSubscriptionEntitlement(ctx, tx, sub, sub.Plan.ProductID, sub.AccessUntil())
+	})
+}
+
+const selectSubscriptionQuery = `
+	SELECT
+		s.id, s.user_id, s.plan_id, s.status, s.current_period_start, s.current_period_end,
+		s.trial_ends_at, s.grace_until, s.canceled_at, s.next_attempt_at, s.failed_attempts,
+		s.payment_reference, s.created_at, s.updated_at, s.version,
+		sp.id, sp.product_id, sp.name, sp.price, sp.billing_interval, sp.interval_count,
+		sp.trial_days, sp.active, sp.created_at, sp.updated_at
+	FROM subscriptions s
+	JOIN subscription_plans sp ON sp.id = s.plan_id
+`
+
+func scanSubscription(row interface{ Scan(...any) error }, sub *Subscription) error {
+	return row.Scan(
+		&sub.ID,
+		&sub.UserID,
+		&sub.PlanID,
+		&sub.Status,
+		&sub.CurrentPeriodStart,
+		&sub.CurrentPeriodEnd,
+		&sub.TrialEndsAt,
+		&sub.GraceUntil,
+		&sub.CanceledAt,
+		&sub.NextAttemptAt,
+		&sub.FailedAttempts,
+		&sub.PaymentReference,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+		&sub.Version,
+		&sub.Plan.ID,
+		&sub.Plan.ProductID,
+		&sub.Plan.Name,
+		&sub.Plan.Price,
+		&sub.Plan.Interval,
+		&sub.Plan.IntervalCount,
+		&sub.Plan.TrialDays,
+		&sub.Plan.Active,
+		&sub.Plan.CreatedAt,
+		&sub.Plan.UpdatedAt,
+	)
+}
+
+func (s *SubscriptionStore) GetByID(ctx context.Context, subscriptionID int64) (*Subscription, error) {
+	query := selectSubscriptionQuery + ` WHERE s.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var sub Subscription
+	if err := scanSubscription(s.db.QueryRowContext(ctx, query, subscriptionID), &sub); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &sub, nil
+}
+
+func (s *SubscriptionStore) GetByUserID(ctx context.Context, userID int64) ([]Subscription, error) {
+	query := selectSubscriptionQuery + ` WHERE s.user_id = $1 ORDER BY s.created_at DESC`
+
+	return s.list(ctx, query, userID)
+}
+
+// GetDue returns subscriptions whose period has ended or whose failed renewal
+// should be retried.
+func (s *SubscriptionStore) GetDue(ctx context.Context, now time.Time, limit int) ([]Subscription, error) {
+	query := selectSubscriptionQuery + `
+		WHERE s.status <> 'expired' AND s.next_attempt_at <= $1
+		ORDER BY s.next_attempt_at ASC
+		LIMIT $2
+	`
+
+	return s.list(ctx, query, now, limit)
+}
+
+func (s *SubscriptionStore) list(ctx context.Context, query string, args ...any) ([]Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := make([]Subscription, 0)
+	for rows.Next() {
+		var sub Subscription
+		if err := scanSubscription(rows, &sub); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// ProcessDue locks the subscription, if it is still due, for process to renew
+// or expire it, then saves it. The lock is held until then, so the
+// subscription can't be canceled by its user or processed by another instance
+// meanwhile. ErrNotFound means it is no longer due, or another instance is
+// processing it.
+func (s *SubscriptionStore) ProcessDue(ctx context.Context, subscriptionID int64, now time.Time, process func(*Subscription)) (*Subscription, error) {
+	var sub Subscription
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := selectSubscriptionQuery + `
+			WHERE s.id = $1 AND s.status <> 'expired' AND s.next_attempt_at <= $2
+			FOR UPDATE OF s SKIP LOCKED
+		`
+
+		queryCtx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := scanSubscription(tx.QueryRowContext(queryCtx, query, subscriptionID, now), &sub); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		process(&sub)
+
+		return updateSubscription(ctx, tx, &sub)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+// Update persists the subscription state and moves the expiry of its
+// entitlement along with it, so access lapses as soon as the subscription ends.
+func (s *SubscriptionStore) Update(ctx context.Context, sub *Subscription) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return updateSubscription(ctx, tx, sub)
+	})
+}
+
+func updateSubscription(ctx context.Context, tx *sql.Tx, sub *Subscription) error {
+	query := `
+		UPDATE subscriptions
+		SET status = $1, current_period_start = $2, current_period_end = $3, trial_ends_at = $4,
+			grace_until = $5, canceled_at = $6, next_attempt_at = $7, failed_attempts = $8,
+			payment_reference = $9, updated_at = $10, version = version + 1
+		WHERE id = $11 AND version = $12
+		RETURNING version, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		sub.Status,
+		sub.CurrentPeriodStart,
+		sub.CurrentPeriodEnd,
+		sub.TrialEndsAt,
+		sub.GraceUntil,
+		sub.CanceledAt,
+		sub.NextAttemptAt,
+		sub.FailedAttempts,
+		sub.PaymentReference,
+		time.Now().UTC(),
+		sub.ID,
+		sub.Version,
+	).Scan(&sub.Version, &sub.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return syncSubscriptionEntitlement(ctx, tx, sub, sub.Plan.ProductID, sub.AccessUntil())
+}
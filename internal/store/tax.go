@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// TaxRule is the rate charged on a product type sold to buyers in a country.
+// A nil ProductType covers every type without a more specific rule.
+type TaxRule struct {
+	ID          int64      `json:"id"`
+	Country     string     `json:"country"`
+	ProductType *string    `json:"product_type"`
+	Name        string     `json:"name"`
+	Rate        float64    `json:"rate"`
+	ValidFrom   time.Time  `json:"valid_from"`
+	ValidUntil  *time.Time `json:"valid_until"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type TaxRuleStore struct {
+	db *sql.DB
+}
+
+const selectTaxRuleQuery = `
+	SELECT id, country, product_type, name, rate, valid_from, valid_until, created_at, updated_at
+	FROM tax_rules
+`
+
+func scanTaxRule(row interface{ Scan(...any) error }, rule *TaxRule) error {
+	return row.Scan(
+		&rule.ID,
+		&rule.Country,
+		&rule.ProductType,
+		&rule.Name,
+		&rule.Rate,
+		&rule.ValidFrom,
+		&rule.ValidUntil,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+}
+
+// FindRule returns the rule in force at the given time, preferring a rule for
+// the product type over the country-wide one. ErrNotFound means no tax applies.
+// Rules are valid from and until whole UTC days, both included.
+func (s *TaxRuleStore) FindRule(ctx context.Context, country, productType string, at time.Time) (*TaxRule, error) {
+	query := selectTaxRuleQuery + `
+		WHERE country = $1
+			AND (product_type = $2 OR product_type IS NULL)
+			AND valid_from <= $3::date
+			AND (valid_until IS NULL OR valid_until >= $3::date)
+		ORDER BY product_type NULLS LAST, valid_from DESC
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var rule TaxRule
+	if err := scanTaxRule(s.db.QueryRowContext(ctx, query, country, productType, at.UTC().Format(time.DateOnly)), &rule); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rule, nil
+}
+
+func (s *TaxRuleStore) GetByID(ctx context.Context, ruleID int64) (*TaxRule, error) {
+	query := selectTaxRuleQuery + ` WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var rule TaxRule
+	if err := scanTaxRule(s.db.QueryRowContext(ctx, query, ruleID), &rule); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rule, nil
+}
+
+func (s *TaxRuleStore) List(ctx context.Context, country string) ([]TaxRule, error) {
+	query := selectTaxRuleQuery
+	params := []interface{}{}
+
+	if country != "" {
+		query += ` WHERE country = $1`
+		params = append(params, country)
+	}
+
+	query += ` ORDER BY country, product_type NULLS FIRST, valid_from DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]TaxRule, 0)
+	for rows.Next() {
+		var rule TaxRule
+		if err := scanTaxRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (s *TaxRuleStore) Create(ctx context.Context, rule *TaxRule) error {
+	query := `
+		INSERT INTO tax_rules (country, product_type, name, rate, valid_from, valid_until)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		rule.Country,
+		rule.ProductType,
+		rule.Name,
+		rule.Rate,
+		rule.ValidFrom,
+		rule.ValidUntil,
+	).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tax_rules_country_type_valid_from_key"`:
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TaxRuleStore) Update(ctx context.Context, rule *TaxRule) error {
+	query := `
+		UPDATE tax_rules
+		SET name = $1, rate = $2, valid_from = $3, valid_until = $4, updated_at = $5
+		WHERE id = $6
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		rule.Name,
+		rule.Rate,
+		rule.ValidFrom,
+		rule.ValidUntil,
+		time.Now().UTC(),
+		rule.ID,
+	).Scan(&rule.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		case err.Error() == `pq: duplicate key value violates unique constraint "tax_rules_country_type_valid_from_key"`:
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TaxRuleStore) Delete(ctx context.Context, ruleID int64) error {
+	query := `DELETE FROM tax_rules WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, ruleID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -3,7 +3,11 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type UserWishlist struct {
@@ -48,3 +52,352 @@ func (s *WishlistStore) Remove(ctx context.Context, userID, productID int64) err
 	}
 	return nil
 }
+
+// WishlistItem is a wishlisted product with when it was added.
+type WishlistItem struct {
+	Product
+	AddedAt time.Time `json:"added_at"`
+}
+
+// WishlistCollection is a named group of products of a user's wishlist. It can
+// be shared read-only through its slug.
+type WishlistCollection struct {
+	ID            int64     `json:"id"`
+	UserID        int64     `json:"user_id"`
+	Name          string    `json:"name"`
+	ShareSlug     *string   `json:"share_slug"`
+	ItemCount     int       `json:"item_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	OwnerUsername string    `json:"owner_username"`
+}
+
+const selectWishlistItemQuery = `
+	SELECT
+		p.id, p.user_id, p.name, p.price, p.pricing_mode, p.suggested_price, p.description, p.categories, p.type,
+		p.is_bundle, p.created_at, p.updated_at, p.version,
+		p.rating_average, p.rating_count, p.rating_1_count, p.rating_2_count, p.rating_3_count, p.rating_4_count, p.rating_5_count,
+		w.created_at
+`
+
+const selectWishlistCollectionQuery = `
+	SELECT
+		c.id, c.user_id, c.name, c.share_slug, c.created_at, c.updated_at, u.username,
+		(SELECT COUNT(*) FROM wishlist_collection_items i WHERE i.collection_id = c.id)
+	FROM wishlist_collections c
+	JOIN users u ON u.id = c.user_id
+`
+
+// wishlistKeyset orders wishlist items latest additions first.
+var wishlistKeyset = keyset{sort: "wishlist", columns: []keysetColumn{
+	{"w.created_at", true}, {"p.id", true},
+}}
+
+// GetByUserID lists the user's wishlist, latest additions first.
+func (s *WishlistStore) GetByUserID(ctx context.Context, userID int64, fq PaginationFeedQuery) (*Page[WishlistItem], error) {
+	from := `
+		FROM user_wishlist w
+		JOIN products p ON p.id = w.product_id
+		WHERE w.user_id = $1
+	`
+
+	return s.queryItems(ctx, from, userID, fq)
+}
+
+func (s *WishlistStore) GetCollections(ctx context.Context, userID int64) ([]WishlistCollection, error) {
+	query := selectWishlistCollectionQuery + `
+		WHERE c.user_id = $1
+		ORDER BY c.name
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := make([]WishlistCollection, 0)
+	for rows.Next() {
+		var c WishlistCollection
+		if err := scanWishlistCollection(rows, &c); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+func (s *WishlistStore) GetCollectionByID(ctx context.Context, collectionID int64) (*WishlistCollection, error) {
+	query := selectWishlistCollectionQuery + `WHERE c.id = $1`
+
+	return s.getCollection(ctx, query, collectionID)
+}
+
+func (s *WishlistStore) GetCollectionBySlug(ctx context.Context, slug string) (*WishlistCollection, error) {
+	query := selectWishlistCollectionQuery + `WHERE c.share_slug = $1`
+
+	return s.getCollection(ctx, query, slug)
+}
+
+func (s *WishlistStore) getCollection(ctx context.Context, query string, args ...any) (*WishlistCollection, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var collection WishlistCollection
+	if err := scanWishlistCollection(s.db.QueryRowContext(ctx, query, args...), &collection); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &collection, nil
+}
+
+func (s *WishlistStore) CreateCollection(ctx context.Context, collection *WishlistCollection) error {
+	query := `
+		INSERT INTO wishlist_collections (user_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, collection.UserID, collection.Name).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "wishlist_collections_user_name_key"`:
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateCollection renames the collection and sets its share slug; a nil slug
+// stops sharing it.
+func (s *WishlistStore) UpdateCollection(ctx context.Context, collection *WishlistCollection) error {
+	query := `
+		UPDATE wishlist_collections
+		SET name = $2, share_slug = $3, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, collection.ID, collection.Name, collection.ShareSlug).Scan(&collection.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		case err.Error() == `pq: duplicate key value violates unique constraint "wishlist_collections_user_name_key"`:
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *WishlistStore) DeleteCollection(ctx context.Context, collectionID int64) error {
+	query := `DELETE FROM wishlist_collections WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, collectionID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetCollectionItems lists the products of a collection, latest additions first.
+func (s *WishlistStore) GetCollectionItems(ctx context.Context, collectionID int64, fq PaginationFeedQuery) (*Page[WishlistItem], error) {
+	from := `
+		FROM wishlist_collection_items w
+		JOIN products p ON p.id = w.product_id
+		WHERE w.collection_id = $1
+	`
+
+	return s.queryItems(ctx, from, collectionID, fq)
+}
+
+// AddToCollection puts the product in the collection, adding it to the owner's
+// wishlist first if needed.
+func (s *WishlistStore) AddToCollection(ctx context.Context, collection *WishlistCollection, productID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		wishlistQuery := `
+			INSERT INTO user_wishlist (user_id, product_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`
+
+		if _, err := tx.ExecContext(ctx, wishlistQuery, collection.UserID, productID); err != nil {
+			return err
+		}
+
+		itemQuery := `
+			INSERT INTO wishlist_collection_items (collection_id, user_id, product_id)
+			VALUES ($1, $2, $3)
+		`
+
+		_, err := tx.ExecContext(ctx, itemQuery, collection.ID, collection.UserID, productID)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "wishlist_collection_items_pkey"`:
+				return ErrConflict
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// RemoveFromCollection takes the product out of the collection. It stays in the
+// wishlist.
+func (s *WishlistStore) RemoveFromCollection(ctx context.Context, collectionID, productID int64) error {
+	query := `DELETE FROM wishlist_collection_items WHERE collection_id = $1 AND product_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, collectionID, productID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// queryItems pages through the wishlist items selected by the FROM and WHERE
+// clauses, which filter on the id in $1. The query's cursor takes over its
+// offset.
+func (s *WishlistStore) queryItems(ctx context.Context, from string, id int64, fq PaginationFeedQuery) (*Page[WishlistItem], error) {
+	// one extra row tells whether there is another page
+	args := []any{id, fq.Limit + 1}
+	query := selectWishlistItemQuery + from
+
+	backward := false
+	if fq.Cursor != nil {
+		after, params, err := wishlistKeyset.after(fq.Cursor, args)
+		if err != nil {
+			return nil, err
+		}
+		query += after
+		args = params
+		backward = fq.Cursor.Before
+	}
+
+	query += wishlistKeyset.orderBy(backward) + " LIMIT $2"
+
+	if fq.Cursor == nil {
+		args = append(args, fq.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]WishlistItem, 0)
+	for rows.Next() {
+		var item WishlistItem
+		if err := rows.Scan(
+			&item.ID,
+			&item.UserID,
+			&item.Name,
+			&item.Price,
+			&item.PricingMode,
+			&item.SuggestedPrice,
+			&item.Description,
+			pq.Array(&item.Categories),
+			&item.Type,
+			&item.IsBundle,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+			&item.Version,
+			&item.Rating.Average,
+			&item.Rating.Count,
+			&item.Rating.Histogram.One,
+			&item.Rating.Histogram.Two,
+			&item.Rating.Histogram.Three,
+			&item.Rating.Histogram.Four,
+			&item.Rating.Histogram.Five,
+			&item.AddedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newPage(items, fq.Limit, fq.Cursor, fq.Cursor != nil || fq.Offset > 0, func(item WishlistItem) Cursor {
+		return wishlistKeyset.cursor(item.AddedAt, item.ID)
+	}), nil
+}
+
+func scanWishlistCollection(row interface{ Scan(...any) error }, collection *WishlistCollection) error {
+	return row.Scan(
+		&collection.ID,
+		&collection.UserID,
+		&collection.Name,
+		&collection.ShareSlug,
+		&collection.CreatedAt,
+		&collection.UpdatedAt,
+		&collection.OwnerUsername,
+		&collection.ItemCount,
+	)
+}
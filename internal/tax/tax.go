@@ -0,0 +1,115 @@
+package tax
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/edwrdc/digitally/internal/store"
+)
+
+var ErrInvalidVATID = errors.New("invalid VAT ID")
+
+// RuleFinder looks up the rate in force for a country and product type.
+// It returns store.ErrNotFound when the sale is not taxed.
+type RuleFinder interface {
+	FindRule(ctx context.Context, country, productType string, at time.Time) (*store.TaxRule, error)
+}
+
+// VATValidator decides whether a business VAT ID is valid for the country it
+// was given with. Implementations can check the format only or ask a registry.
+type VATValidator interface {
+	Validate(ctx context.Context, country, vatID string) (bool, error)
+}
+
+type Item struct {
+	ProductType string
+	Amount      float64
+}
+
+type Result struct {
+	Lines         []store.OrderTaxLine
+	TaxTotal      float64
+	ReverseCharge bool
+}
+
+type Calculator struct {
+	rules RuleFinder
+	vat   VATValidator
+}
+
+func NewCalculator(rules RuleFinder, vat VATValidator) *Calculator {
+	return &Calculator{rules: rules, vat: vat}
+}
+
+// Calculate works out the tax owed on items sold to the given billing address.
+// Prices are tax exclusive and tax is charged at the rate of the buyer's
+// country. Buyers with a valid business VAT ID account for the tax themselves
+// under the reverse charge, so no tax lines are added for them.
+func (c *Calculator) Calculate(ctx context.Context, address *store.BillingAddress, items []Item, at time.Time) (*Result, error) {
+	result := &Result{Lines: make([]store.OrderTaxLine, 0)}
+
+	if address.VATID != "" {
+		if err := c.CheckVATID(ctx, address.Country, address.VATID); err != nil {
+			return nil, err
+		}
+
+		result.ReverseCharge = true
+		return result, nil
+	}
+
+	// items taxed under the same rule share a single line
+	lines := make(map[int64]int)
+
+	for _, item := range items {
+		rule, err := c.rules.FindRule(ctx, address.Country, item.ProductType, at)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				continue
+			default:
+				return nil, err
+			}
+		}
+
+		i, ok := lines[rule.ID]
+		if !ok {
+			result.Lines = append(result.Lines, store.OrderTaxLine{
+				Name:    rule.Name,
+				Country: rule.Country,
+				Rate:    rule.Rate,
+			})
+			i = len(result.Lines) - 1
+			lines[rule.ID] = i
+		}
+
+		result.Lines[i].TaxableAmount = round(result.Lines[i].TaxableAmount + item.Amount)
+	}
+
+	for i := range result.Lines {
+		line := &result.Lines[i]
+		line.Amount = round(line.TaxableAmount * line.Rate)
+		result.TaxTotal = round(result.TaxTotal + line.Amount)
+	}
+
+	return result, nil
+}
+
+// CheckVATID returns ErrInvalidVATID when the validator rejects the VAT ID.
+func (c *Calculator) CheckVATID(ctx context.Context, country, vatID string) error {
+	valid, err := c.vat.Validate(ctx, country, vatID)
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		return ErrInvalidVATID
+	}
+
+	return nil
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
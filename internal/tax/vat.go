@@ -0,0 +1,67 @@
+package tax
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// vatFormats holds the VAT ID formats of the EU member states and the UK,
+// without the country prefix.
+var vatFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^\d{9}$`),
+	"DK": regexp.MustCompile(`^\d{8}$`),
+	"EE": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[A-Z0-9]{2}\d{9}$`),
+	"GB": regexp.MustCompile(`^(\d{9}|\d{12}|GD\d{3}|HA\d{3})$`),
+	"GR": regexp.MustCompile(`^\d{9}$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^\d{7}[A-W][A-I]?$|^\d[A-Z+*]\d{5}[A-W]$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^\d{8}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{10}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^\d{2,10}$`),
+	"SE": regexp.MustCompile(`^\d{12}$`),
+	"SI": regexp.MustCompile(`^\d{8}$`),
+	"SK": regexp.MustCompile(`^\d{10}$`),
+}
+
+// FormatValidator only checks that a VAT ID is well formed for its country.
+// It does not confirm the ID is registered, a registry lookup such as VIES
+// can be plugged in behind VATValidator for that.
+type FormatValidator struct{}
+
+func NewFormatValidator() *FormatValidator {
+	return &FormatValidator{}
+}
+
+func (v *FormatValidator) Validate(ctx context.Context, country, vatID string) (bool, error) {
+	format, ok := vatFormats[country]
+	if !ok {
+		return false, nil
+	}
+
+	id := strings.ToUpper(strings.NewReplacer(" ", "", "-", "", ".", "").Replace(vatID))
+
+	// Greek VAT IDs use the EL prefix instead of the country code
+	prefix := country
+	if country == "GR" {
+		prefix = "EL"
+	}
+	id = strings.TrimPrefix(id, prefix)
+
+	return format.MatchString(id), nil
+}